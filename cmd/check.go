@@ -0,0 +1,82 @@
+package cmd
+
+import (
+  "context"
+  "fmt"
+  "regexp"
+  "sort"
+  "strings"
+
+  "github.com/hashicorp/terraform-plugin-framework/diag"
+  "github.com/hashicorp/terraform-plugin-framework/path"
+)
+
+// checkSeverities lists how failed checks are reported.
+var checkSeverities = []string{"warning", "error"}
+
+// checkMessageVariable matches the variables of a check message, written `${name}` so that other dollar signs are kept.
+var checkMessageVariable = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// checkMessage expands the message of a failed check, whose variables are the ones of the command,
+// and its outputs as `${stdout}` and `${stderr}` and its exit status as `${status}`.
+func checkMessage(message string, env map[string]string, result commandResult) string {
+  return checkMessageVariable.ReplaceAllStringFunc(message, func(variable string) string {
+    switch name := variable[2 : len(variable)-1]; name {
+    case "stdout":
+      return strings.TrimRight(result.Stdout, "\n")
+    case "stderr":
+      return strings.TrimRight(result.Stderr, "\n")
+    case "status":
+      return fmt.Sprintf("%d", result.Status)
+    default:
+      return env[name]
+    }
+  })
+}
+
+// runChecks runs the checks of the resource against its current state, and reports the failing ones.
+func (r *resourceCommand) runChecks(ctx context.Context, operation string, data *resourceCommandModel) diag.Diagnostics {
+  var diags diag.Diagnostics
+  if len(data.Check) == 0 {
+    return diags
+  }
+
+  inputs, d := data.inputValues()
+  if d.HasError() {
+    diags.Append(d...)
+    return diags
+  }
+  env := make(map[string]string)
+  for k, v := range inputs {
+    env[fmt.Sprintf("INPUT_%s", k)] = v
+  }
+  for k, v := range data.states() {
+    env[fmt.Sprintf("STATE_%s", k)] = v.ValueString()
+  }
+
+  // Checks are a set, run in a stable order, without reordering the model written into the state
+  checks := append([]resourceCommandCheckModel(nil), data.Check...)
+  sort.SliceStable(checks, func(i, j int) bool {
+    return checks[i].Cmd < checks[j].Cmd
+  })
+
+  for _, check := range checks {
+    runner := r.runner(operation, data.Id).withBlock("check").withDelivery(data.delivery(inputs, nil)).withOutputLimit(check.MaxOutputBytes)
+    var result commandResult
+    ctx, result = runner.run(ctx, &diags, check.Cmd, env, nil)
+    if result.Err == nil {
+      continue
+    }
+
+    detail := runner.commandError(ctx, path.Root("check"), "Check failed", check.Cmd, result).Detail()
+    if !check.Message.IsNull() {
+      detail = redact(ctx, checkMessage(check.Message.ValueString(), mergeMaps(env, map[string]string{"OPERATION": operation}), result))
+    }
+    if check.Severity.ValueString() == "warning" {
+      diags.AddAttributeWarning(path.Root("check"), "Check failed", detail)
+    } else {
+      diags.AddAttributeError(path.Root("check"), "Check failed", detail)
+    }
+  }
+  return diags
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckMessage(t *testing.T) {
+	env := map[string]string{"INPUT_name": "web", "STATE_cost": "5"}
+	result := commandResult{Stdout: "out\n", Stderr: "err\n", Status: 3}
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"plain message", "plain message"},
+		{"${INPUT_name} costs ${STATE_cost}", "web costs 5"},
+		{"stdout: ${stdout}, stderr: ${stderr}, status: ${status}", "stdout: out, stderr: err, status: 3"},
+		{"cost $5", "cost $5"},
+		{"$INPUT_name", "$INPUT_name"},
+		{"${missing}", ""},
+		{"$$ and ${ and $}", "$$ and ${ and $}"},
+		{"${INPUT_name}${STATE_cost}", "web5"},
+	}
+
+	for _, test := range tests {
+		if got := checkMessage(test.message, env, result); got != test.want {
+			t.Errorf("checkMessage(%q) = %q, want %q", test.message, got, test.want)
+		}
+	}
+}
+
+func TestRunChecksKeepsOrder(t *testing.T) {
+	r := resourceCommand{shell: shellLocal{}, options: defaultProviderCmdData}
+	data := resourceCommandModel{
+		Check: []resourceCommandCheckModel{{Cmd: "true # b"}, {Cmd: "true # a"}},
+	}
+	if diags := r.runChecks(context.Background(), "read", &data); diags.HasError() {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+	if data.Check[0].Cmd != "true # b" || data.Check[1].Cmd != "true # a" {
+		t.Errorf("the checks of the resource are reordered: %v", data.Check)
+	}
+}
@@ -0,0 +1,598 @@
+package cmd
+
+import (
+  "bufio"
+  "context"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "sync/atomic"
+  "time"
+  "unicode/utf8"
+
+  "github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+  "github.com/hashicorp/terraform-plugin-framework-validators/mapvalidator"
+  "github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+  "github.com/hashicorp/terraform-plugin-framework/diag"
+  "github.com/hashicorp/terraform-plugin-framework/path"
+  "github.com/hashicorp/terraform-plugin-framework/tfsdk"
+  "github.com/hashicorp/terraform-plugin-framework/types"
+  "github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// Outcomes of a command, depending on its exit code
+const (
+  outcomeSuccess = "success"
+  outcomeUnchanged = "unchanged"
+  outcomeAbsent = "absent"
+  outcomeRetry = "retry"
+  outcomeFailure = "failure"
+)
+
+// Commands asking for a retry are executed at most commandMaxAttempts times, waiting commandRetryDelay between attempts
+const commandMaxAttempts = 10
+const commandRetryDelay = 2 * time.Second
+
+// exitCodesAttribute returns the schema of the `exit_codes` of a command block, given the meaning of the outcomes for this block.
+func exitCodesAttribute(meaning string) tfsdk.Attribute {
+  return tfsdk.Attribute{
+    MarkdownDescription: fmt.Sprintf("Meaning of the exit codes of the command: %s (default: 0 is a success, anything else is a failure)", meaning),
+    Optional:            true,
+    Type:                types.MapType{types.StringType},
+    Validators: []tfsdk.AttributeValidator{
+      mapvalidator.KeysAre(stringvalidator.RegexMatches(regexp.MustCompile(`^\d+$`), "must be an exit code")),
+      mapvalidator.ValuesAre(stringvalidator.OneOf(outcomeSuccess, outcomeUnchanged, outcomeAbsent, outcomeRetry)),
+    },
+  }
+}
+
+// maxOutputBytesAttribute returns the schema of the `max_output_bytes` of a command block.
+func maxOutputBytesAttribute() tfsdk.Attribute {
+  return tfsdk.Attribute{
+    MarkdownDescription: "Size of each output of the command kept in memory (default: `max_output_bytes` of the provider, 0 for no limit). An output exceeding it cannot be captured into a variable",
+    Optional:            true,
+    Type:                types.Int64Type,
+    Validators: []tfsdk.AttributeValidator{
+      int64validator.AtLeast(0),
+    },
+  }
+}
+
+// stdinAttribute returns the schema of the `stdin` of a command block.
+// As stdin often holds secrets, it is sensitive and redacted from the logs and the diagnostics.
+func stdinAttribute() tfsdk.Attribute {
+  return tfsdk.Attribute{
+    MarkdownDescription: "Content piped into the standard input of the command, which unlike the environment is neither limited in size nor visible to other processes",
+    Optional:            true,
+    Sensitive:           true,
+    Type:                types.StringType,
+  }
+}
+
+// stdinEncodingAttribute returns the schema of the `stdin_encoding` of a command block.
+func stdinEncodingAttribute() tfsdk.Attribute {
+  return tfsdk.Attribute{
+    MarkdownDescription: "Encoding of `stdin`: `text` (default), or `base64` and `hex` to pipe binary content",
+    Optional:            true,
+    Type:                types.StringType,
+    Validators: []tfsdk.AttributeValidator{
+      stringvalidator.OneOf(encodings...),
+    },
+  }
+}
+
+// captureAttribute returns the schema of the `capture` of a read block.
+func captureAttribute() tfsdk.Attribute {
+  return tfsdk.Attribute{
+    MarkdownDescription: "What the variable holds: `stdout` (default), `stderr`, `combined` (stdout and stderr), `exit_code`, or `success` (`true` if the exit code is 0, `false` otherwise). With `exit_code` and `success`, a non-zero exit code is not an error",
+    Optional:            true,
+    Type:                types.StringType,
+    Validators: []tfsdk.AttributeValidator{
+      stringvalidator.OneOf("stdout", "stderr", "combined", "exit_code", "success"),
+    },
+  }
+}
+
+// encodingAttribute returns the schema of the `encoding` of a read block.
+func encodingAttribute() tfsdk.Attribute {
+  return tfsdk.Attribute{
+    MarkdownDescription: "Encoding of the captured output: `text` (default), or `base64` and `hex` for binary outputs",
+    Optional:            true,
+    Type:                types.StringType,
+    Validators: []tfsdk.AttributeValidator{
+      stringvalidator.OneOf(encodings...),
+    },
+  }
+}
+
+// inputEncodingsAttribute returns the schema of the `input_encodings` of a resource or a data source.
+func inputEncodingsAttribute() tfsdk.Attribute {
+  return tfsdk.Attribute{
+    MarkdownDescription: "Encoding of the inputs, by name: `text` (default), or `base64` and `hex` to give binary values to the commands. Values are decoded before being exported, which cannot hold NUL bytes",
+    Optional:            true,
+    Type:                types.MapType{types.StringType},
+    Validators: []tfsdk.AttributeValidator{
+      mapvalidator.ValuesAre(stringvalidator.OneOf(encodings...)),
+    },
+  }
+}
+
+// commandResult holds the result of the execution of a command.
+type commandResult struct {
+  Stdout string
+  Stderr string
+  Combined string
+  // Status is the exit code of the command, or -1 if the command did not exit normally
+  Status int
+  // Signal is the signal that killed the command, if any
+  Signal string
+  // Duration is the time spent executing the command, including its retries
+  Duration time.Duration
+  // Outcome is mapped from the exit code of the command
+  Outcome string
+  // Err is nil unless Outcome is "failure"
+  Err error
+  // Spilled holds the total size of each stream exceeding max_output_bytes
+  Spilled map[string]int64
+  // LogFile is the file where the full output of a failed command exceeding max_output_bytes is written, if any
+  LogFile string
+  // StateOutput is the content written into $STATE_OUTPUT by a command run with withStateOutput
+  StateOutput string
+}
+
+// commandOutcome maps an exit code to its outcome.
+// Without explicit mapping, 0 is a success and anything else a failure.
+func commandOutcome(status int, exitCodes map[string]string) string {
+  if outcome, found := exitCodes[strconv.Itoa(status)]; found {
+    return outcome
+  }
+  if status == 0 {
+    return outcomeSuccess
+  }
+  return outcomeFailure
+}
+
+// commandRunner executes the commands of an operation on a resource or on a data source.
+type commandRunner struct {
+  shell shell
+  options providerCmdData
+  // id is the id of the resource, "" for data sources and resources not created yet
+  id string
+  // block names the block of the commands in the logs, like `create` or `read.<name>`
+  block string
+  // operation is the name of the operation: create, read, update or destroy, exported as OPERATION
+  operation string
+  // logStdout is false for commands whose stdout may hold sensitive values
+  logStdout bool
+  // rawOutput is the output captured as binary data, which is not filtered of workflow commands ("" for none)
+  rawOutput string
+  // stateOutput is true for commands writing their state into the file $STATE_OUTPUT
+  stateOutput bool
+  // maxOutputBytes is the size of each output kept in memory (0 for no limit)
+  maxOutputBytes int
+  // stdin is piped into the standard input of the commands
+  stdin string
+  // delivery describes how the inputs are given to the commands (nil for env variables only)
+  delivery *inputDelivery
+  // env holds variables exported to all the commands of the runner
+  env map[string]string
+}
+
+// withEnv returns a runner exporting additional variables to the commands.
+func (runner commandRunner) withEnv(env map[string]string) commandRunner {
+  runner.env = mergeMaps(runner.env, env)
+  return runner
+}
+
+// withBlock returns a runner whose logs name the given block.
+func (runner commandRunner) withBlock(block string) commandRunner {
+  runner.block = block
+  return runner
+}
+
+// withCapture returns a runner keeping as is the output captured by a read, if its encoding is binary.
+func (runner commandRunner) withCapture(capture string, encoding string) commandRunner {
+  runner.rawOutput = ""
+  if encoding == "" || encoding == "text" {
+    return runner
+  }
+  switch capture {
+  case "", "stdout":
+    runner.rawOutput = "stdout"
+  case "stderr", "combined":
+    runner.rawOutput = capture
+  }
+  return runner
+}
+
+// withStateOutput returns a runner giving the commands a file $STATE_OUTPUT, whose content is returned as StateOutput.
+func (runner commandRunner) withStateOutput() commandRunner {
+  runner.stateOutput = true
+  return runner
+}
+
+// withOutputLimit returns a runner whose outputs are limited by the max_output_bytes of a block, if set.
+func (runner commandRunner) withOutputLimit(maxOutputBytes types.Int64) commandRunner {
+  if !maxOutputBytes.IsNull() && !maxOutputBytes.IsUnknown() {
+    runner.maxOutputBytes = int(maxOutputBytes.ValueInt64())
+  }
+  return runner
+}
+
+// logFields returns the fields tagging the logs of a command.
+func (runner commandRunner) logFields(cmd string, stream string) map[string]any {
+  return map[string]any{
+    "resource_id": runner.id,
+    "block": runner.block,
+    "operation": runner.operation,
+    "stream": stream,
+    "cmd": cmd,
+  }
+}
+
+// streamLines returns a writer logging every line of an output stream as soon as it is printed.
+func (runner commandRunner) streamLines(ctx context.Context, cmd string, stream string, lastOutput *atomic.Int64) *LineWriter {
+  fields := runner.logFields(cmd, stream)
+  // The content of $STATE_OUTPUT printed after its marker is neither logged nor interpreted
+  inStateOutput := false
+  return &LineWriter{
+    Emit: func(line string) {
+      lastOutput.Store(time.Now().UnixNano())
+      if inStateOutput {
+        return
+      }
+      if runner.stateOutput && stream == "stdout" && line == stateOutputMarker {
+        inStateOutput = true
+        return
+      }
+      // Secrets must be registered before they are printed, unless the output is binary data
+      if command, ok := parseWorkflowCommand(line); ok && command.Name == "add-mask" && stream != runner.rawOutput {
+        ctx = addSecrets(ctx, command.Message)
+        return
+      }
+      line = redact(ctx, line)
+      if stream == "stderr" {
+        tflog.Warn(ctx, line, fields)
+      } else {
+        tflog.Info(ctx, line, fields)
+      }
+    },
+  }
+}
+
+// heartbeat logs periodically that a command is still running while it does not print anything.
+// The returned function stops the heartbeat.
+func (runner commandRunner) heartbeat(ctx context.Context, cmd string, lastOutput *atomic.Int64) func() {
+  interval := runner.options.HeartbeatInterval
+  if interval <= 0 {
+    return func() {}
+  }
+  fields := runner.logFields(cmd, "heartbeat")
+  start := time.Now()
+  done := make(chan struct{})
+
+  go func() {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+      select {
+      case <-done:
+        return
+      case now := <-ticker.C:
+        silence := now.Sub(time.Unix(0, lastOutput.Load()))
+        if silence >= interval {
+          tflog.Info(ctx, fmt.Sprintf("Command still running after %s, without output for %s", now.Sub(start).Round(time.Second), silence.Round(time.Second)), fields)
+        }
+      }
+    }
+  }()
+
+  return func() {
+    close(done)
+  }
+}
+
+// withStdin returns a runner piping the stdin of a block, decoded according to its encoding, into the commands.
+func (runner commandRunner) withStdin(stdin types.String, encoding types.String) (commandRunner, error) {
+  var err error
+  runner.stdin, err = decodeInput(encoding.ValueString(), stdin.ValueString())
+  if err != nil {
+    return runner, fmt.Errorf("stdin is not valid %s: %s", encoding.ValueString(), err)
+  }
+  return runner, nil
+}
+
+// run executes a command, maps its exit code to an outcome, and processes the workflow commands of its outputs.
+// The command is executed again as long as its outcome is "retry".
+func (runner commandRunner) run(ctx context.Context, diags *diag.Diagnostics, cmd string, env map[string]string, exitCodes map[string]string) (context.Context, commandResult) {
+  var result commandResult
+  start := time.Now()
+  // The secrets registered while streaming are shared through the redactor of the context, which must exist beforehand
+  ctx = addSecrets(ctx)
+
+  env = mergeMaps(env, runner.env, map[string]string{"OPERATION": runner.operation})
+  env, cleanup, err := runner.deliverInputs(ctx, env)
+  defer cleanup()
+  if err != nil {
+    result.Status = -1
+    result.Outcome = outcomeFailure
+    result.Err = err
+    return ctx, result
+  }
+
+  command := cmd
+  if runner.stateOutput {
+    command = wrapStateOutputCommand(cmd)
+  }
+
+  // The outputs of the last attempt are kept until the end, in case they must be written into a log file
+  var out *CommandOutput
+  defer func() {
+    out.Close()
+  }()
+
+attempts:
+  for attempt := 1; ; attempt += 1 {
+    var lastOutput atomic.Int64
+    lastOutput.Store(time.Now().UnixNano())
+    if out != nil {
+      out.Close()
+    }
+    out = NewCommandOutput(runner.maxOutputBytes)
+    stdoutLines := runner.streamLines(ctx, cmd, "stdout", &lastOutput)
+    stderrLines := runner.streamLines(ctx, cmd, "stderr", &lastOutput)
+    if runner.logStdout {
+      out.Tee(stdoutLines, stderrLines)
+    } else {
+      out.Tee(nil, stderrLines)
+    }
+
+    stopHeartbeat := runner.heartbeat(ctx, cmd, &lastOutput)
+    var stdin io.Reader
+    if runner.stdin != "" {
+      stdin = strings.NewReader(runner.stdin)
+    }
+    err := runner.shell.Execute(command, env, stdin, out)
+    stopHeartbeat()
+    stdoutLines.Flush()
+    stderrLines.Flush()
+
+    result.Stdout, result.Stderr, result.Combined = out.Stdout.String(), out.Stderr.String(), out.Combined.String()
+    result.Spilled = nil
+    for stream, buf := range map[string]*BoundedBuffer{"stdout": &out.Stdout, "stderr": &out.Stderr, "combined": &out.Combined} {
+      if buf.Spilled() {
+        if result.Spilled == nil {
+          result.Spilled = make(map[string]int64)
+        }
+        result.Spilled[stream] = buf.Size()
+        tflog.Warn(ctx, fmt.Sprintf("The %s of the command (%d bytes) exceeds max_output_bytes", stream, buf.Size()), runner.logFields(cmd, stream))
+      }
+    }
+    result.Duration = time.Since(start)
+
+    result.Status, result.Signal, result.Err = exitStatus(err)
+    if result.Err != nil {
+      result.Status = -1
+      result.Outcome = outcomeFailure
+      break attempts
+    }
+
+    result.Outcome = commandOutcome(result.Status, exitCodes)
+    switch result.Outcome {
+    case outcomeFailure:
+      result.Err = err
+      if result.Err == nil {
+        result.Err = fmt.Errorf("exit status %d is mapped to a failure", result.Status)
+      }
+      break attempts
+    case outcomeRetry:
+      if attempt >= commandMaxAttempts {
+        result.Outcome = outcomeFailure
+        result.Err = fmt.Errorf("exit status %d still asks for a retry after %d attempts", result.Status, attempt)
+        break attempts
+      }
+      tflog.Info(ctx, fmt.Sprintf("Exit status %d asks for a retry (attempt %d/%d)", result.Status, attempt, commandMaxAttempts), map[string]any{"cmd": cmd})
+      select {
+      case <-ctx.Done():
+        result.Outcome = outcomeFailure
+        result.Err = ctx.Err()
+        break attempts
+      case <-time.After(commandRetryDelay):
+      }
+    default:
+      break attempts
+    }
+  }
+
+  // The content of $STATE_OUTPUT is split off first, as its values are not workflow commands
+  if _, spilled := result.Spilled["stdout"]; runner.stateOutput && !spilled {
+    var err error
+    result.Stdout, result.StateOutput, err = splitStateOutput(result.Stdout)
+    if err != nil && result.Outcome == outcomeSuccess {
+      result.Outcome = outcomeFailure
+      result.Err = err
+    }
+    result.Combined, _, _ = splitStateOutput(result.Combined)
+  }
+
+  // Only the workflow commands of the last attempt are executed, so that retries do not duplicate diagnostics
+  ctx, result.Stdout, result.Stderr, result.Combined = processOutputs(ctx, diags, result.Stdout, result.Stderr, result.Combined, runner.rawOutput)
+
+  // The outputs kept in memory are truncated, the full ones are read before their spill files are removed
+  if result.Err != nil && result.Spilled != nil {
+    if logfile, err := runner.writeLog(ctx, cmd, out.Stdout.Reader(), out.Stderr.Reader()); err == nil {
+      result.LogFile = logfile
+    } else {
+      tflog.Warn(ctx, fmt.Sprintf("Unable to write the output of the command into a log file: %s", err), runner.logFields(cmd, "log"))
+    }
+  }
+  return ctx, result
+}
+
+// spilledError reports that an output exceeding max_output_bytes cannot be used as a value.
+func spilledError(stream string, result commandResult) error {
+  return fmt.Errorf("The %s of the command (%d bytes) exceeds max_output_bytes", stream, result.Spilled[stream])
+}
+
+// captureOutput selects the value of a read command according to its capture mode.
+// An output exceeding max_output_bytes is an error rather than a truncated value.
+func captureOutput(capture string, result commandResult) (string, error) {
+  switch capture {
+  case "", "stdout", "stderr", "combined":
+    stream := capture
+    if stream == "" {
+      stream = "stdout"
+    }
+    if _, found := result.Spilled[stream]; found && result.Err == nil {
+      return "", spilledError(stream, result)
+    }
+  }
+  switch capture {
+  case "", "stdout":
+    return result.Stdout, result.Err
+  case "stderr":
+    return result.Stderr, result.Err
+  case "combined":
+    return result.Combined, result.Err
+  case "exit_code":
+    if result.Status < 0 {
+      return "", result.Err
+    }
+    return fmt.Sprintf("%d", result.Status), nil
+  case "success":
+    if result.Status < 0 {
+      return "", result.Err
+    }
+    return fmt.Sprintf("%t", result.Outcome == outcomeSuccess), nil
+  default:
+    return "", fmt.Errorf("Unknown capture mode: %s", capture)
+  }
+}
+
+// outputTail returns the last size bytes of an output, and whether it has been truncated.
+func outputTail(output string, size int) (string, bool) {
+  if len(output) <= size {
+    return output, false
+  }
+  i := len(output) - size
+  // Do not cut an UTF-8 character
+  for i < len(output) && !utf8.RuneStart(output[i]) {
+    i += 1
+  }
+  return output[i:], true
+}
+
+// logFilesKept is the number of log files kept in the log directory: the oldest ones are removed first.
+const logFilesKept = 30
+
+// writeLog writes the full output of a command into a new log file, and returns its path.
+// Outputs are redacted line by line, as they may not fit in memory.
+func (runner commandRunner) writeLog(ctx context.Context, cmd string, stdout io.Reader, stderr io.Reader) (string, error) {
+  file, err := os.CreateTemp(runner.options.DiagnosticLogDir, "terraform-provider-cmd-*.log")
+  if err != nil {
+    return "", err
+  }
+  defer file.Close()
+
+  w := bufio.NewWriter(file)
+  fmt.Fprintf(w, "##### Command #####\n%s\n", redact(ctx, cmd))
+  for _, output := range []struct{ title string; r io.Reader }{{"Stdout", stdout}, {"Stderr", stderr}} {
+    fmt.Fprintf(w, "##### %s #####\n", output.title)
+    lines := bufio.NewReader(output.r)
+    for {
+      line, err := lines.ReadString('\n')
+      w.WriteString(redact(ctx, line))
+      if err == io.EOF {
+        break
+      } else if err != nil {
+        return "", err
+      }
+    }
+    w.WriteString("\n")
+  }
+  if err := w.Flush(); err != nil {
+    return "", err
+  }
+  rotateLogFiles(filepath.Dir(file.Name()))
+  return file.Name(), nil
+}
+
+// rotateLogFiles removes the oldest log files of a directory, keeping only the logFilesKept most recent ones.
+// Log files are complete once written, so that removing them does not disturb the commands running in parallel.
+func rotateLogFiles(dir string) {
+  paths, err := filepath.Glob(filepath.Join(dir, "terraform-provider-cmd-*.log"))
+  if err != nil || len(paths) <= logFilesKept {
+    return
+  }
+
+  type logFile struct {
+    path string
+    info os.FileInfo
+  }
+  var files []logFile
+  for _, path := range paths {
+    if info, err := os.Stat(path); err == nil {
+      files = append(files, logFile{path, info})
+    }
+  }
+  sort.Slice(files, func(i, j int) bool {
+    return files[i].info.ModTime().After(files[j].info.ModTime())
+  })
+  for i := logFilesKept; i < len(files); i++ {
+    os.Remove(files[i].path)
+  }
+}
+
+// commandError builds the diagnostic of a failed command, attached to the block it comes from.
+func (runner commandRunner) commandError(ctx context.Context, block path.Path, summary string, cmd string, result commandResult) diag.Diagnostic {
+  var detail strings.Builder
+  size := runner.options.DiagnosticOutputSize
+
+  fmt.Fprintf(&detail, "Operation: %s\n", runner.operation)
+  fmt.Fprintf(&detail, "Block: %s\n", block)
+  fmt.Fprintf(&detail, "Host: %s\n", runner.shell.Host())
+  if result.Signal != "" {
+    fmt.Fprintf(&detail, "Signal: %s\n", result.Signal)
+  } else if result.Status >= 0 {
+    fmt.Fprintf(&detail, "Exit status: %d\n", result.Status)
+  }
+  fmt.Fprintf(&detail, "Error: %s\n", result.Err)
+  fmt.Fprintf(&detail, "Duration: %s\n", result.Duration.Round(time.Millisecond))
+
+  stdout, stdoutTruncated := outputTail(result.Stdout, size)
+  stderr, stderrTruncated := outputTail(result.Stderr, size)
+  stdout = strings.TrimRight(stdout, "\n")
+  stderr = strings.TrimRight(stderr, "\n")
+  if result.LogFile != "" {
+    fmt.Fprintf(&detail, "Full output: %s\n", result.LogFile)
+  } else if (stdoutTruncated || stderrTruncated) && result.Spilled == nil {
+    if logfile, err := runner.writeLog(ctx, cmd, strings.NewReader(result.Stdout), strings.NewReader(result.Stderr)); err == nil {
+      fmt.Fprintf(&detail, "Full output: %s\n", logfile)
+    } else {
+      tflog.Warn(ctx, fmt.Sprintf("Unable to write the output of the command into a log file: %s", err), map[string]any{"cmd": cmd})
+    }
+  }
+
+  fmt.Fprintf(&detail, "\nCommand:\n%s\n", cmd)
+  if len(stdout) > 0 {
+    if stdoutTruncated {
+      fmt.Fprintf(&detail, "\nStdout (last %d bytes):\n%s\n", size, stdout)
+    } else {
+      fmt.Fprintf(&detail, "\nStdout:\n%s\n", stdout)
+    }
+  }
+  if len(stderr) > 0 {
+    if stderrTruncated {
+      fmt.Fprintf(&detail, "\nStderr (last %d bytes):\n%s\n", size, stderr)
+    } else {
+      fmt.Fprintf(&detail, "\nStderr:\n%s\n", stderr)
+    }
+  }
+
+  return diag.NewAttributeErrorDiagnostic(block, summary, redact(ctx, detail.String()))
+}
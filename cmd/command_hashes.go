@@ -0,0 +1,143 @@
+package cmd
+
+import (
+  "context"
+  "crypto/sha256"
+  "encoding/json"
+  "fmt"
+  "sort"
+  "strings"
+
+  "github.com/hashicorp/terraform-plugin-framework/diag"
+  "github.com/hashicorp/terraform-plugin-framework/path"
+  "github.com/hashicorp/terraform-plugin-framework/tfsdk"
+  "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// onCommandChanges lists what happens when the create, update or destroy commands are modified:
+//   - replace: the resource is replaced
+//   - update: every update rule is run, and the state is reloaded accordingly
+//   - ignore: the new commands are only used by the next operations
+var onCommandChanges = []string{"replace", "update", "ignore"}
+
+// commandHashesKey is the key of the private state holding the hashes of the commands the resource was applied with.
+const commandHashesKey = "command_hashes"
+
+// privateGetter and privateSetter give access to the private state of a resource.
+type privateGetter interface {
+  GetKey(ctx context.Context, key string) ([]byte, diag.Diagnostics)
+}
+type privateSetter interface {
+  SetKey(ctx context.Context, key string, value []byte) diag.Diagnostics
+}
+
+// hashCommands hashes the commands of an operation, in order.
+func hashCommands(cmds []string) string {
+  return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(cmds, "\x00"))))
+}
+
+// commandHashes returns the hashes of the create, update and destroy commands of the resource, by operation.
+func (data *resourceCommandModel) commandHashes() map[string]string {
+  var create, update, destroy []string
+  for _, c := range data.Create {
+    create = append(create, c.Cmd)
+  }
+  for _, u := range data.Update {
+    update = append(update, u.Cmd)
+  }
+  // Update blocks are a set, whose order is not meaningful
+  sort.Strings(update)
+  for _, d := range data.Destroy {
+    destroy = append(destroy, d.Cmd)
+  }
+  return map[string]string{
+    "create": hashCommands(create),
+    "update": hashCommands(update),
+    "destroy": hashCommands(destroy),
+  }
+}
+
+// storeCommandHashes records the commands the resource has been applied with into its private state.
+func (data *resourceCommandModel) storeCommandHashes(ctx context.Context, private privateSetter) diag.Diagnostics {
+  hashes, err := json.Marshal(data.commandHashes())
+  if err != nil {
+    var diags diag.Diagnostics
+    diags.AddError("Unable to store command hashes", err.Error())
+    return diags
+  }
+  return private.SetKey(ctx, commandHashesKey, hashes)
+}
+
+// changedCommands lists, in order, the operations whose commands differ from the ones the resource has been applied with.
+// Resources applied before the hashes were recorded have no changed commands.
+func (data *resourceCommandModel) changedCommands(ctx context.Context, private privateGetter) ([]string, diag.Diagnostics) {
+  stored, diags := private.GetKey(ctx, commandHashesKey)
+  if diags.HasError() || len(stored) == 0 {
+    return nil, diags
+  }
+  var hashes map[string]string
+  if err := json.Unmarshal(stored, &hashes); err != nil {
+    diags.AddError("Unable to read command hashes", err.Error())
+    return nil, diags
+  }
+
+  var changed []string
+  for op, hash := range data.commandHashes() {
+    if hashes[op] != hash {
+      changed = append(changed, op)
+    }
+  }
+  sort.Strings(changed)
+  return changed, diags
+}
+
+// commandChangeUpdates returns the update rules to run because of modified commands, or nil if there are none.
+func (data *resourceCommandModel) commandChangeUpdates(changed []string) []*resourceCommandUpdateModel {
+  if len(changed) == 0 || data.OnCommandChange.ValueString() != "update" {
+    return nil
+  }
+  updates := make([]*resourceCommandUpdateModel, 0, len(data.Update))
+  for i := range data.Update {
+    updates = append(updates, &data.Update[i])
+  }
+  sortUpdates(updates)
+  return updates
+}
+
+// commandChangePlanModifier replaces the resource when the commands of an operation are modified and `on_command_change = "replace"`.
+type commandChangePlanModifier struct {
+  operation string
+}
+
+func (_ commandChangePlanModifier) Description(ctx context.Context) string {
+  return "Checks if the resource must be replaced because its commands are modified"
+}
+
+func (_ commandChangePlanModifier) MarkdownDescription(ctx context.Context) string {
+  return "Checks if the resource must be replaced because its commands are modified"
+}
+
+func (m commandChangePlanModifier) Modify(ctx context.Context, req tfsdk.ModifyAttributePlanRequest, resp *tfsdk.ModifyAttributePlanResponse) {
+  if req.State.Raw.IsNull() || !req.State.Raw.IsKnown() {
+    return
+  }
+  if req.Plan.Raw.IsNull() || !req.Plan.Raw.IsKnown() {
+    return
+  }
+
+  var onCommandChange types.String
+  resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("on_command_change"), &onCommandChange)...)
+  if onCommandChange.ValueString() != "replace" {
+    return
+  }
+
+  var config resourceCommandModel
+  resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+  changed, diags := config.changedCommands(ctx, req.Private)
+  resp.Diagnostics.Append(diags...)
+  for _, op := range changed {
+    if op == m.operation {
+      resp.RequiresReplace = true
+    }
+  }
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+)
+
+func testRunner(operation string) commandRunner {
+	return commandRunner{
+		shell:     shellLocal{},
+		options:   defaultProviderCmdData,
+		block:     operation,
+		operation: operation,
+		logStdout: true,
+	}
+}
+
+func TestRunRetryWorkflowCommands(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "attempted")
+	cmd := `if [ -e "$MARKER" ]; then echo "::warning::last attempt"; exit 0; fi; : > "$MARKER"; echo "::warning::first attempt"; exit 3`
+
+	var diags diag.Diagnostics
+	_, result := testRunner("create").run(context.Background(), &diags, cmd, map[string]string{"MARKER": marker}, map[string]string{"3": "retry"})
+	if result.Outcome != outcomeSuccess {
+		t.Fatalf("unexpected outcome %s: %s", result.Outcome, result.Err)
+	}
+	if diags.WarningsCount() != 1 || diags[0].Detail() != "last attempt" {
+		t.Errorf("expected a single warning from the last attempt, got %v", diags)
+	}
+	if result.Stdout != "" {
+		t.Errorf("workflow commands should be removed from stdout, got %q", result.Stdout)
+	}
+}
+
+func TestRunStreamsMaskedLines(t *testing.T) {
+	var logs bytes.Buffer
+	ctx := tflogtest.RootLogger(context.Background(), &logs)
+	runner := testRunner("read").withBlock("read.a")
+	runner.id = "some-id"
+
+	var diags diag.Diagnostics
+	_, result := runner.run(ctx, &diags, `echo "::add-mask::s3cret"; echo "value s3cret"`, nil, nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	entries, err := tflogtest.MultilineJSONDecode(&logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed := false
+	for _, entry := range entries {
+		message, _ := entry["@message"].(string)
+		if strings.Contains(message, "s3cret") {
+			t.Errorf("secret logged: %v", entry)
+		}
+		if message == "value ***" {
+			streamed = true
+			if entry["resource_id"] != "some-id" || entry["block"] != "read.a" || entry["stream"] != "stdout" {
+				t.Errorf("unexpected log fields: %v", entry)
+			}
+		}
+	}
+	if !streamed {
+		t.Errorf("the redacted line has not been logged: %v", entries)
+	}
+}
+
+func TestRunSpilledFailure(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	runner := testRunner("create")
+	runner.maxOutputBytes = 16
+	runner.options.DiagnosticLogDir = t.TempDir()
+
+	var diags diag.Diagnostics
+	cmd := `i=0; while [ $i -lt 100 ]; do echo "line $i"; i=$((i+1)); done; exit 1`
+	_, result := runner.run(context.Background(), &diags, cmd, nil, nil)
+	if result.Outcome != outcomeFailure {
+		t.Fatalf("unexpected outcome %s", result.Outcome)
+	}
+	if result.Spilled["stdout"] != 790 {
+		t.Errorf("unexpected spilled sizes: %v", result.Spilled)
+	}
+	if len(result.Stdout) > 64 {
+		t.Errorf("stdout is not truncated: %q", result.Stdout)
+	}
+
+	if files, _ := os.ReadDir(tmp); len(files) > 0 {
+		t.Errorf("spill files are not removed: %v", files)
+	}
+	log, err := os.ReadFile(result.LogFile)
+	if err != nil {
+		t.Fatalf("unable to read the log file: %s", err)
+	}
+	if !strings.Contains(string(log), "line 0\n") || !strings.Contains(string(log), "line 50\n") || !strings.Contains(string(log), "line 99\n") {
+		t.Errorf("the log file does not hold the full output:\n%s", log)
+	}
+	if detail := runner.commandError(context.Background(), path.Root("create"), "Command error", cmd, result).Detail(); !strings.Contains(detail, result.LogFile) {
+		t.Errorf("the diagnostic does not give the log file:\n%s", detail)
+	}
+}
+
+func TestRunBinaryCapture(t *testing.T) {
+	cmd := `printf '::warning::not a command\n\001\002'; echo "::notice::stderr command" >&2`
+	tests := []struct {
+		capture      string
+		encoding     string
+		wantStdout   string
+		wantWarnings int
+	}{
+		{capture: "stdout", encoding: "text", wantStdout: "\001\002", wantWarnings: 2},
+		{capture: "stdout", encoding: "base64", wantStdout: "::warning::not a command\n\001\002", wantWarnings: 1},
+		{capture: "", encoding: "hex", wantStdout: "::warning::not a command\n\001\002", wantWarnings: 1},
+		{capture: "stderr", encoding: "base64", wantStdout: "\001\002", wantWarnings: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.capture+"/"+test.encoding, func(t *testing.T) {
+			var diags diag.Diagnostics
+			_, result := testRunner("read").withCapture(test.capture, test.encoding).run(context.Background(), &diags, cmd, nil, nil)
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			if result.Stdout != test.wantStdout {
+				t.Errorf("got stdout %q, want %q", result.Stdout, test.wantStdout)
+			}
+			if diags.WarningsCount() != test.wantWarnings {
+				t.Errorf("got %d warnings, want %d: %v", diags.WarningsCount(), test.wantWarnings, diags)
+			}
+		})
+	}
+}
+
+func TestRunStateOutputWorkflowCommands(t *testing.T) {
+	cmd := `printf 'a<<EOF\n::error::not a command\n::add-mask::not a secret\nEOF\n' > "$STATE_OUTPUT"; echo "::warning::command"; echo "out"`
+
+	var diags diag.Diagnostics
+	ctx, result := testRunner("create").withStateOutput().run(context.Background(), &diags, cmd, map[string]string{"PATH": os.Getenv("PATH")}, nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Stdout != "out\n" || result.Combined != "out\n" {
+		t.Errorf("unexpected outputs %q and %q", result.Stdout, result.Combined)
+	}
+	values, err := parseStateOutput(result.StateOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "::error::not a command\n::add-mask::not a secret"; values["a"] != want {
+		t.Errorf("got %q, want %q", values["a"], want)
+	}
+	if diags.ErrorsCount() != 0 || diags.WarningsCount() != 1 {
+		t.Errorf("only the workflow commands printed on stdout should be executed, got %v", diags)
+	}
+	if redact(ctx, "not a secret") != "not a secret" {
+		t.Errorf("the state output registered a mask")
+	}
+}
+
+func TestRunBinaryCaptureMasks(t *testing.T) {
+	var diags diag.Diagnostics
+	ctx, result := testRunner("read").withCapture("stderr", "base64").run(context.Background(), &diags, `echo "::add-mask::abcdef" >&2; echo "::add-mask::ghijkl"`, nil, nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Stderr != "::add-mask::abcdef\n" {
+		t.Errorf("the binary stderr is modified: %q", result.Stderr)
+	}
+	if redact(ctx, "abcdef ghijkl") != "abcdef ***" {
+		t.Errorf("only the mask printed on stdout should be registered, got %q", redact(ctx, "abcdef ghijkl"))
+	}
+}
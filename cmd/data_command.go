@@ -5,28 +5,35 @@ import (
   "fmt"
   "regexp"
 
+  "github.com/hashicorp/terraform-plugin-framework-validators/setvalidator"
   "github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
   //"github.com/hashicorp/terraform-plugin-framework/attr"
   "github.com/hashicorp/terraform-plugin-framework/datasource"
   "github.com/hashicorp/terraform-plugin-framework/diag"
-  //"github.com/hashicorp/terraform-plugin-framework/path"
+  "github.com/hashicorp/terraform-plugin-framework/path"
   //"github.com/hashicorp/terraform-plugin-framework/provider"
   //"github.com/hashicorp/terraform-plugin-framework/resource"
   "github.com/hashicorp/terraform-plugin-framework/tfsdk"
   "github.com/hashicorp/terraform-plugin-framework/types"
-  "github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
 // Ensure the implementation satisfies the desired interfaces.
-var _ datasource.DataSource = &dataSourceCommand{}
+var (
+  _ datasource.DataSource              = &dataSourceCommand{}
+  _ datasource.DataSourceWithConfigure = &dataSourceCommand{}
+)
 
 type dataSourceCommand struct {
   shell shell
   shellFactory shellFactory
+  options providerCmdData
 }
 
 type dataSourceCommandModel struct {
   Input map[string]types.String `tfsdk:"inputs"`
+  TypedInputs dynamicValue `tfsdk:"typed_inputs"`
+  InputEncodings map[string]string `tfsdk:"input_encodings"`
+  InputDelivery []string `tfsdk:"input_delivery"`
   State map[string]types.String `tfsdk:"state"`
   ConnectionOptions types.Object `tfsdk:"connection"`
   Read []dataSourceCommandReadModel `tfsdk:"read"`
@@ -34,6 +41,11 @@ type dataSourceCommandModel struct {
 type dataSourceCommandReadModel struct {
   Name string `tfsdk:"name"`
   Cmd string `tfsdk:"cmd"`
+  Capture types.String `tfsdk:"capture"`
+  Encoding types.String `tfsdk:"encoding"`
+  MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
+  Stdin types.String `tfsdk:"stdin"`
+  StdinEncoding types.String `tfsdk:"stdin_encoding"`
 }
 
 func (d *dataSourceCommand) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
@@ -56,6 +68,23 @@ func (d *dataSourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.D
         MarkdownDescription: "Inputs",
         Type: types.MapType{types.StringType},
       },
+      "typed_inputs": {
+        Optional:            true,
+        MarkdownDescription: "Inputs of any type: numbers, bools, lists and nested objects. Scalars are exported as strings, and structured inputs both as JSON and flattened into variables like `INPUT_users_0_name`, which must not collide with one another",
+        Type: dynamicType{},
+        Validators: []tfsdk.AttributeValidator{
+          typedInputsValidator{},
+        },
+      },
+      "input_encodings": inputEncodingsAttribute(),
+      "input_delivery": {
+        Optional:            true,
+        MarkdownDescription: "How inputs are given to the commands: `env` exports `INPUT_<name>` variables, `files` writes every input into a file of the directory `$INPUT_DIR`, and `json` writes the inputs into the JSON file `$CONTEXT_JSON` (default: `[\"env\"]`). Files are removed once the command is done",
+        Type: types.SetType{types.StringType},
+        Validators: []tfsdk.AttributeValidator{
+          setvalidator.ValuesAre(stringvalidator.OneOf(inputDeliveries...)),
+        },
+      },
       "state": {
         Computed:            true,
         MarkdownDescription: "State",
@@ -81,15 +110,28 @@ func (d *dataSourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.D
             Required:            true,
             Type:                types.StringType,
           },
+          "capture": captureAttribute(),
+          "encoding": encodingAttribute(),
+          "max_output_bytes": maxOutputBytesAttribute(),
+          "stdin": stdinAttribute(),
+          "stdin_encoding": stdinEncodingAttribute(),
         },
       },
     },
   }, nil
 }
 
+func (d *dataSourceCommand) Configure(_ context.Context, req datasource.ConfigureRequest, _ *datasource.ConfigureResponse) {
+  if options, ok := req.ProviderData.(*providerCmdData); ok {
+    d.options = *options
+  }
+}
+
 func (d *dataSourceCommand) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
   var data dataSourceCommandModel
 
+  ctx = maskSensitive(ctx, req.Config.Raw)
+
   // Read Terraform configuration data into the model
   resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
 
@@ -108,24 +150,49 @@ func (d *dataSourceCommand) Read(ctx context.Context, req datasource.ReadRequest
 
   data.State = make(map[string]types.String)
 
+  inputs, diags := decodeInputs(data.Input, data.InputEncodings)
+  if diags.HasError() {
+    resp.Diagnostics.Append(diags...)
+    return
+  }
+  inputs = mergeMaps(data.TypedInputs.exported(), inputs)
+  contextInputs := data.TypedInputs.contextValues()
+  for k, v := range stringValues(data.Input) {
+    contextInputs[k] = v
+  }
+
+  runner := commandRunner{
+    shell: d.shell,
+    options: d.options,
+    operation: "read",
+    maxOutputBytes: d.options.MaxOutputBytes,
+    delivery: newInputDelivery(data.InputDelivery, inputs, commandContext{Inputs: contextInputs}),
+  }
   env := make(map[string]string)
-  for k, v := range data.Input {
-    env[fmt.Sprintf("INPUT_%s", k)] = v.ValueString()
+  for k, v := range inputs {
+    env[fmt.Sprintf("INPUT_%s", k)] = v
   }
 
   for _, read := range data.Read {
     name := read.Name
     cmd := read.Cmd
 
-    stdout, stderr, _, err := d.shell.Execute(cmd, env)
-
-    if len(stderr) > 0 {
-      tflog.Warn(ctx, stderr, map[string]any{"cmd": cmd})
+    readRunner, err := runner.withBlock("read." + name).withCapture(read.Capture.ValueString(), read.Encoding.ValueString()).withOutputLimit(read.MaxOutputBytes).withStdin(read.Stdin, read.StdinEncoding)
+    if err != nil {
+      resp.Diagnostics.AddAttributeError(path.Root("read"), fmt.Sprintf("Unable to read %s", name), err.Error())
+      continue
+    }
+    var result commandResult
+    ctx, result = readRunner.run(ctx, &resp.Diagnostics, cmd, env, nil)
+    value, err := captureOutput(read.Capture.ValueString(), result)
+    if err == nil {
+      value, err = encodeOutput(read.Encoding.ValueString(), value)
     }
     if err == nil {
-      data.State[name] = types.StringValue(stdout)
+      data.State[name] = types.StringValue(value)
     } else {
-      resp.Diagnostics.AddError("Command error during reading", fmt.Sprintf("Unable to execute command: %s\n%s\n%s", cmd, err, stderr))
+      result.Err = err
+      resp.Diagnostics.Append(readRunner.commandError(ctx, path.Root("read"), fmt.Sprintf("Unable to read %s", name), cmd, result))
     }
   }
 
@@ -119,3 +119,29 @@ func formatVal(val tftypes.Value) string {
 	formatVal_(val, &out, "")
 	return out.String()
 }
+
+func collectStrings(val tftypes.Value, out *[]string) {
+	if val.IsNull() || !val.IsKnown() {
+		return
+	}
+	t := val.Type()
+	if t.Is(tftypes.List{}) || t.Is(tftypes.Set{}) || t.Is(tftypes.Tuple{}) {
+		var l []tftypes.Value
+		val.As(&l)
+		for _, v := range l {
+			collectStrings(v, out)
+		}
+	} else if t.Is(tftypes.Map{}) || t.Is(tftypes.Object{}) {
+		var m map[string]tftypes.Value
+		val.As(&m)
+		for _, v := range m {
+			collectStrings(v, out)
+		}
+	} else if t.Equal(tftypes.String) {
+		var s string
+		val.As(&s)
+		if s != "" {
+			*out = append(*out, s)
+		}
+	}
+}
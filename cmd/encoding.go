@@ -0,0 +1,64 @@
+package cmd
+
+import (
+  "encoding/base64"
+  "encoding/hex"
+  "fmt"
+
+  "github.com/hashicorp/terraform-plugin-framework/diag"
+  "github.com/hashicorp/terraform-plugin-framework/path"
+  "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// encodings lists the encodings of binary values: text values are kept as is.
+var encodings = []string{"text", "base64", "hex"}
+
+// encodeOutput encodes the raw output of a command so that it can be stored as a string.
+func encodeOutput(encoding string, output string) (string, error) {
+  switch encoding {
+  case "", "text":
+    return output, nil
+  case "base64":
+    return base64.StdEncoding.EncodeToString([]byte(output)), nil
+  case "hex":
+    return hex.EncodeToString([]byte(output)), nil
+  default:
+    return "", fmt.Errorf("Unknown encoding: %s", encoding)
+  }
+}
+
+// decodeInput decodes a value into the raw bytes given to the commands.
+func decodeInput(encoding string, value string) (string, error) {
+  switch encoding {
+  case "", "text":
+    return value, nil
+  case "base64":
+    b, err := base64.StdEncoding.DecodeString(value)
+    return string(b), err
+  case "hex":
+    b, err := hex.DecodeString(value)
+    return string(b), err
+  default:
+    return "", fmt.Errorf("Unknown encoding: %s", encoding)
+  }
+}
+
+// decodeInputs decodes the inputs according to their encoding.
+// Errors do not show the values, as inputs may be sensitive.
+func decodeInputs(inputs map[string]types.String, encodings map[string]string) (map[string]string, diag.Diagnostics) {
+  var diags diag.Diagnostics
+  values := make(map[string]string, len(inputs))
+  for name, input := range inputs {
+    value, err := decodeInput(encodings[name], input.ValueString())
+    if err != nil {
+      diags.AddAttributeError(
+        path.Root("input_encodings").AtMapKey(name),
+        "Unable to decode input",
+        fmt.Sprintf("Input %s is not valid %s: %s", name, encodings[name], err),
+      )
+      continue
+    }
+    values[name] = value
+  }
+  return values, diags
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "path"
+  "strings"
+
+  "github.com/hashicorp/terraform-plugin-framework/types"
+  "github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// inputDeliveries lists the ways inputs can be given to the commands:
+//   - env: INPUT_<name> and PREVIOUS_<name> variables
+//   - files: one file per input in the directory $INPUT_DIR
+//   - json: inputs, previous inputs and state in the JSON file $CONTEXT_JSON
+var inputDeliveries = []string{"env", "files", "json"}
+
+// commandContext is the content of $CONTEXT_JSON.
+type commandContext struct {
+  Inputs map[string]any `json:"inputs"`
+  PreviousInputs map[string]any `json:"previous_inputs,omitempty"`
+  State map[string]string `json:"state"`
+}
+
+// inputDelivery describes how the inputs are given to the commands.
+type inputDelivery struct {
+  // Env exports the inputs as INPUT_<name> and PREVIOUS_<name> variables
+  Env bool
+  // Files holds the content of the files of $INPUT_DIR by input name, or is nil if disabled
+  Files map[string]string
+  // Context is the content of $CONTEXT_JSON, or is nil if disabled
+  Context []byte
+}
+
+// stringValues converts Terraform values into strings, omitting the null and unknown ones.
+func stringValues(values map[string]types.String) map[string]string {
+  strs := make(map[string]string, len(values))
+  for k, v := range values {
+    if !v.IsNull() && !v.IsUnknown() {
+      strs[k] = v.ValueString()
+    }
+  }
+  return strs
+}
+
+// newInputDelivery prepares the delivery of the inputs according to the input_delivery setting.
+// Files hold the decoded inputs, whereas $CONTEXT_JSON holds the values as configured.
+// A nil delivery means the default: inputs are only exported as env variables.
+func newInputDelivery(modes []string, inputs map[string]string, context commandContext) *inputDelivery {
+  if modes == nil {
+    return nil
+  }
+
+  delivery := &inputDelivery{}
+  for _, mode := range modes {
+    switch mode {
+    case "env":
+      delivery.Env = true
+    case "files":
+      delivery.Files = inputs
+      if delivery.Files == nil {
+        delivery.Files = make(map[string]string)
+      }
+    case "json":
+      if context.Inputs == nil {
+        context.Inputs = make(map[string]any)
+      }
+      if context.State == nil {
+        context.State = make(map[string]string)
+      }
+      delivery.Context, _ = json.Marshal(context)
+    }
+  }
+  return delivery
+}
+
+// withDelivery returns a runner giving the inputs to the commands as described by delivery.
+func (runner commandRunner) withDelivery(delivery *inputDelivery) commandRunner {
+  runner.delivery = delivery
+  return runner
+}
+
+// validInputFileName checks that an input can be materialized as a file of $INPUT_DIR.
+func validInputFileName(name string) error {
+  if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+    return fmt.Errorf("Input %q cannot be delivered as a file", name)
+  }
+  return nil
+}
+
+// deliverInputs creates the files of $INPUT_DIR and $CONTEXT_JSON with the shell, and returns the environment of the command.
+// The returned function removes the files, and must be called even on error.
+func (runner commandRunner) deliverInputs(ctx context.Context, env map[string]string) (map[string]string, func(), error) {
+  var dirs []string
+  cleanup := func() {
+    for _, dir := range dirs {
+      if err := runner.shell.RemoveAll(dir); err != nil {
+        tflog.Warn(ctx, fmt.Sprintf("Unable to remove %s: %s", dir, err))
+      }
+    }
+  }
+
+  delivery := runner.delivery
+  if delivery == nil {
+    return env, cleanup, nil
+  }
+
+  delivered := make(map[string]string, len(env))
+  for k, v := range env {
+    if !delivery.Env && (strings.HasPrefix(k, "INPUT_") || strings.HasPrefix(k, "PREVIOUS_")) {
+      continue
+    }
+    delivered[k] = v
+  }
+
+  if delivery.Files != nil {
+    dir, err := runner.shell.TempDir()
+    if err != nil {
+      return nil, cleanup, fmt.Errorf("Unable to create INPUT_DIR: %s", err)
+    }
+    dirs = append(dirs, dir)
+    for name, value := range delivery.Files {
+      if err := validInputFileName(name); err != nil {
+        return nil, cleanup, err
+      }
+      if err := runner.shell.Send(path.Join(dir, name), []byte(value)); err != nil {
+        return nil, cleanup, fmt.Errorf("Unable to write input %s into INPUT_DIR: %s", name, err)
+      }
+    }
+    delivered["INPUT_DIR"] = dir
+  }
+
+  if delivery.Context != nil {
+    dir, err := runner.shell.TempDir()
+    if err != nil {
+      return nil, cleanup, fmt.Errorf("Unable to create CONTEXT_JSON: %s", err)
+    }
+    dirs = append(dirs, dir)
+    file := path.Join(dir, "context.json")
+    if err := runner.shell.Send(file, delivery.Context); err != nil {
+      return nil, cleanup, fmt.Errorf("Unable to write CONTEXT_JSON: %s", err)
+    }
+    delivered["CONTEXT_JSON"] = file
+  }
+
+  return delivered, cleanup, nil
+}
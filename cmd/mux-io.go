@@ -2,9 +2,16 @@ package cmd
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"os"
+	"strings"
+	"sync"
 )
 
+// lineMaxLength is the size above which a line is emitted even if it is not complete yet.
+const lineMaxLength = 64 * 1024
+
 type MultiWriter struct {
 	Writers []io.Writer
 }
@@ -24,17 +31,176 @@ func (muxed MultiWriter) Write(p []byte) (int, error) {
 	return towrite, nil
 }
 
+// LockedWriter serializes the writes of several goroutines into the same writer.
+type LockedWriter struct {
+	Mutex  *sync.Mutex
+	Writer io.Writer
+}
+
+func (locked LockedWriter) Write(p []byte) (int, error) {
+	locked.Mutex.Lock()
+	defer locked.Mutex.Unlock()
+	return locked.Writer.Write(p)
+}
+
+// LineWriter calls Emit for every complete line written into it, without its line terminator.
+// The last incomplete line is emitted by Flush.
+type LineWriter struct {
+	Emit    func(line string)
+	pending bytes.Buffer
+}
+
+func (lines *LineWriter) Write(p []byte) (int, error) {
+	lines.pending.Write(p)
+	for {
+		i := bytes.IndexByte(lines.pending.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(lines.pending.Next(i + 1))
+		lines.Emit(strings.TrimRight(line, "\r\n"))
+	}
+	if lines.pending.Len() >= lineMaxLength {
+		lines.Flush()
+	}
+	return len(p), nil
+}
+
+func (lines *LineWriter) Flush() {
+	if lines.pending.Len() > 0 {
+		lines.Emit(lines.pending.String())
+		lines.pending.Reset()
+	}
+}
+
+// BoundedBuffer keeps in memory at most Limit bytes of what is written into it: its head and its tail.
+// Once the limit is exceeded, the whole content is spilled into a file of SpillDir (default: the temporary directory),
+// readable only by the user and removed by Close. A Limit of 0 disables the limit.
+type BoundedBuffer struct {
+	Limit    int
+	SpillDir string
+	head     bytes.Buffer
+	tail     []byte
+	size     int64
+	spill    *os.File
+	spilled  bool
+}
+
+func (buf *BoundedBuffer) Write(p []byte) (int, error) {
+	buf.size += int64(len(p))
+	if !buf.spilled {
+		if buf.Limit <= 0 || buf.head.Len()+len(p) <= buf.Limit {
+			buf.head.Write(p)
+			return len(p), nil
+		}
+
+		buf.spilled = true
+		content := append(append([]byte(nil), buf.head.Bytes()...), p...)
+		buf.startSpill(content)
+		headSize := buf.Limit / 2
+		buf.head.Reset()
+		buf.head.Write(content[:headSize])
+		buf.tail = content[headSize:]
+	} else {
+		if buf.spill != nil {
+			if _, err := buf.spill.Write(p); err != nil {
+				buf.spill.Close()
+				buf.spill = nil
+			}
+		}
+		buf.tail = append(buf.tail, p...)
+	}
+
+	if tailSize := buf.Limit - buf.Limit/2; len(buf.tail) > tailSize {
+		buf.tail = buf.tail[len(buf.tail)-tailSize:]
+	}
+	return len(p), nil
+}
+
+// startSpill creates the spill file with the content written so far.
+// Without spill file, the content is still truncated in memory.
+func (buf *BoundedBuffer) startSpill(content []byte) {
+	file, err := os.CreateTemp(buf.SpillDir, "terraform-provider-cmd-*.spill")
+	if err != nil {
+		return
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return
+	}
+	buf.spill = file
+}
+
+// Spilled returns whether the content exceeded the limit.
+func (buf *BoundedBuffer) Spilled() bool {
+	return buf.spilled
+}
+
+// Reader returns a reader of the whole content, as long as it could be spilled.
+// Otherwise, it reads the content kept in memory.
+func (buf *BoundedBuffer) Reader() io.Reader {
+	if buf.spill == nil {
+		return strings.NewReader(buf.String())
+	}
+	return io.NewSectionReader(buf.spill, 0, buf.size)
+}
+
+// Size returns the total size of the content, including the bytes not kept in memory.
+func (buf *BoundedBuffer) Size() int64 {
+	return buf.size
+}
+
+// String returns the content kept in memory, with a marker between its head and its tail if bytes were omitted.
+func (buf *BoundedBuffer) String() string {
+	if !buf.spilled {
+		return buf.head.String()
+	}
+	omitted := buf.size - int64(buf.head.Len()) - int64(len(buf.tail))
+	return fmt.Sprintf("%s\n[... %d bytes omitted ...]\n%s", buf.head.String(), omitted, buf.tail)
+}
+
+// Close removes the spill file, whose content is not readable anymore.
+func (buf *BoundedBuffer) Close() {
+	if buf.spill != nil {
+		buf.spill.Close()
+		os.Remove(buf.spill.Name())
+		buf.spill = nil
+	}
+}
+
 type CommandOutput struct {
-	Stdout       bytes.Buffer
-	Stderr       bytes.Buffer
-	Combined     bytes.Buffer
+	Stdout       BoundedBuffer
+	Stderr       BoundedBuffer
+	Combined     BoundedBuffer
 	StdoutWriter MultiWriter
 	StderrWriter MultiWriter
+	combinedLock sync.Mutex
 }
 
-func NewCommandOutput() *CommandOutput {
+// NewCommandOutput creates the outputs of a command, each of them keeping at most limit bytes in memory.
+func NewCommandOutput(limit int) *CommandOutput {
 	var out CommandOutput
-	out.StdoutWriter.Writers = []io.Writer{&out.Stdout, &out.Combined}
-	out.StderrWriter.Writers = []io.Writer{&out.Stderr, &out.Combined}
+	for _, buf := range []*BoundedBuffer{&out.Stdout, &out.Stderr, &out.Combined} {
+		buf.Limit = limit
+	}
+	combined := LockedWriter{&out.combinedLock, &out.Combined}
+	out.StdoutWriter.Writers = []io.Writer{&out.Stdout, combined}
+	out.StderrWriter.Writers = []io.Writer{&out.Stderr, combined}
 	return &out
 }
+
+// Tee forwards stdout and stderr to additional writers.
+func (out *CommandOutput) Tee(stdout io.Writer, stderr io.Writer) {
+	if stdout != nil {
+		out.StdoutWriter.Writers = append(out.StdoutWriter.Writers, stdout)
+	}
+	if stderr != nil {
+		out.StderrWriter.Writers = append(out.StderrWriter.Writers, stderr)
+	}
+}
+
+func (out *CommandOutput) Close() {
+	out.Stdout.Close()
+	out.Stderr.Close()
+	out.Combined.Close()
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBoundedBuffer(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		writes      []string
+		wantString  string
+		wantSpilled bool
+	}{
+		{
+			name:       "no limit",
+			limit:      0,
+			writes:     []string{"0123456789", "abcdefghij"},
+			wantString: "0123456789abcdefghij",
+		},
+		{
+			name:       "under the limit",
+			limit:      10,
+			writes:     []string{"01234", "56789"},
+			wantString: "0123456789",
+		},
+		{
+			name:        "single write over the limit",
+			limit:       10,
+			writes:      []string{"0123456789abcdefghij"},
+			wantString:  "01234\n[... 10 bytes omitted ...]\nfghij",
+			wantSpilled: true,
+		},
+		{
+			name:        "writes after the limit",
+			limit:       10,
+			writes:      []string{"01234567", "89abc", "defgh", "ij"},
+			wantString:  "01234\n[... 10 bytes omitted ...]\nfghij",
+			wantSpilled: true,
+		},
+		{
+			name:        "odd limit",
+			limit:       5,
+			writes:      []string{"0123456789"},
+			wantString:  "01\n[... 5 bytes omitted ...]\n789",
+			wantSpilled: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			buf := BoundedBuffer{Limit: test.limit, SpillDir: dir}
+			full := strings.Join(test.writes, "")
+			for _, w := range test.writes {
+				if n, err := buf.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("write returned %d, %v", n, err)
+				}
+			}
+
+			if got := buf.String(); got != test.wantString {
+				t.Errorf("got %q, want %q", got, test.wantString)
+			}
+			if buf.Spilled() != test.wantSpilled {
+				t.Errorf("spilled is %t, want %t", buf.Spilled(), test.wantSpilled)
+			}
+			if buf.Size() != int64(len(full)) {
+				t.Errorf("size is %d, want %d", buf.Size(), len(full))
+			}
+			content, err := io.ReadAll(buf.Reader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != full {
+				t.Errorf("full content is %q, want %q", content, full)
+			}
+
+			buf.Close()
+			if files, _ := os.ReadDir(dir); len(files) > 0 {
+				t.Errorf("spill files are not removed: %v", files)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+  "context"
+  "fmt"
+  "sort"
+  "strings"
+
+  "github.com/hashicorp/terraform-plugin-framework/tfsdk"
+  "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// explainReplacement tells why the modified inputs cannot be applied by the update rules, or returns "" if they can.
+func (rules *resourceCommandModel) explainReplacement(state map[string]types.String, plan map[string]types.String) string {
+  modified, _, _ := inputChanges(state, plan)
+  if len(modified) == 0 {
+    return ""
+  }
+  for _, key := range modified {
+    if triggersCover(rules.ReplaceOn, []string{key}) {
+      return fmt.Sprintf("input %s is modified and listed in replace_on", key)
+    }
+  }
+  if rules.get_updates(state, plan) != nil {
+    return ""
+  }
+
+  if rules.UpdateStrategy.ValueString() != "compose" {
+    return fmt.Sprintf("no update rule has triggers matching all the modified inputs: %s", strings.Join(modified, ", "))
+  }
+  var unmatched []string
+  for _, key := range modified {
+    if triggersCover(rules.IgnoreChangesOf, []string{key}) {
+      continue
+    }
+    matched := false
+    for _, update := range rules.Update {
+      if len(update.Triggers) > 0 && triggersCover(update.Triggers, []string{key}) {
+        matched = true
+        break
+      }
+    }
+    if !matched {
+      unmatched = append(unmatched, key)
+    }
+  }
+  return fmt.Sprintf("no update rule matches the modified inputs: %s", strings.Join(unmatched, ", "))
+}
+
+// explainUpdate describes the update planned for the resource: what is modified, the update rules to run and the state variables to reload.
+func (planned statePlan) explainUpdate() string {
+  var parts []string
+
+  if len(planned.changedCommands) > 0 {
+    parts = append(parts, fmt.Sprintf("modified commands: %s", strings.Join(planned.changedCommands, ", ")))
+  }
+  if modified, _, _ := inputChanges(planned.stateInputs, planned.planInputs); len(modified) > 0 {
+    parts = append(parts, fmt.Sprintf("modified inputs: %s", strings.Join(modified, ", ")))
+  }
+
+  if len(planned.rules) == 0 {
+    parts = append(parts, "no update command")
+  } else {
+    var rules []string
+    for _, rule := range planned.rules {
+      rules = append(rules, rule.label())
+    }
+    parts = append(parts, fmt.Sprintf("update rules: %s", strings.Join(rules, " ")))
+  }
+
+  var reloads []string
+  for name, elem := range planned.elems {
+    if elem.IsUnknown() {
+      reloads = append(reloads, name)
+    }
+  }
+  sort.Strings(reloads)
+  if len(reloads) > 0 {
+    parts = append(parts, fmt.Sprintf("reloads: %s", strings.Join(reloads, ", ")))
+  }
+
+  return "update: " + strings.Join(parts, "; ")
+}
+
+// plannedActionModifier explains in `planned_action` what the plan does with the resource.
+// As Terraform plans the creation of a replaced resource again, the reason of a replacement is also given as a warning.
+type plannedActionModifier struct {}
+
+func (_ plannedActionModifier) Description(ctx context.Context) string {
+  return "Explains whether the resource is created, updated or replaced, and why"
+}
+
+func (_ plannedActionModifier) MarkdownDescription(ctx context.Context) string {
+  return "Explains whether the resource is created, updated or replaced, and why"
+}
+
+func (_ plannedActionModifier) Modify(ctx context.Context, req tfsdk.ModifyAttributePlanRequest, resp *tfsdk.ModifyAttributePlanResponse) {
+  // The previous explanation is kept as long as the resource is not modified
+  if req.Plan.Raw.IsNull() || !req.Plan.Raw.IsKnown() || !req.AttributePlan.IsUnknown() {
+    return
+  }
+  if req.State.Raw.IsNull() || !req.State.Raw.IsKnown() {
+    resp.AttributePlan = types.StringValue("create")
+    return
+  }
+
+  planned, diags := planStates(ctx, req)
+  resp.Diagnostics.Append(diags...)
+  if resp.Diagnostics.HasError() {
+    return
+  }
+
+  var state resourceCommandModel
+  resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+  if resp.Diagnostics.HasError() {
+    return
+  }
+
+  // Replacements are decided with the rules of the state, as inputPlanModifier does
+  state.UpdateStrategy = planned.config.UpdateStrategy
+  state.ReplaceOn = planned.config.ReplaceOn
+  state.IgnoreChangesOf = planned.config.IgnoreChangesOf
+  reason := state.explainReplacement(planned.stateInputs, planned.planInputs)
+  if reason == "" && len(planned.changedCommands) > 0 && planned.config.OnCommandChange.ValueString() == "replace" {
+    reason = fmt.Sprintf("modified commands: %s", strings.Join(planned.changedCommands, ", "))
+  }
+
+  if reason != "" {
+    resp.AttributePlan = types.StringValue("replace: " + reason)
+    resp.Diagnostics.AddAttributeWarning(req.AttributePath, "Resource replacement", fmt.Sprintf("The resource must be replaced: %s.", reason))
+    return
+  }
+  resp.AttributePlan = types.StringValue(planned.explainUpdate())
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+  "context"
+  "sort"
+
+  "github.com/hashicorp/terraform-plugin-framework/path"
+  "github.com/hashicorp/terraform-plugin-framework/resource"
+  "github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// preflight runs the preflight commands when the plan creates or updates the resource, and fails the plan if one of them fails.
+// They run at plan time rather than during the validation of the configuration, as the provider is not configured then.
+func (r *resourceCommand) preflight(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+  if !req.State.Raw.IsNull() && req.Plan.Raw.Equal(req.State.Raw) {
+    return
+  }
+
+  var config, state resourceCommandModel
+  var previous *resourceCommandModel
+  resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+  if !req.State.Raw.IsNull() && req.State.Raw.IsKnown() {
+    resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+    previous = &state
+  }
+  if resp.Diagnostics.HasError() || len(config.Preflight) == 0 {
+    return
+  }
+
+  sh, diags := r.planShell(ctx, config, false)
+  resp.Diagnostics.Append(diags...)
+  if diags.HasError() {
+    return
+  }
+  if sh == nil {
+    tflog.Info(ctx, "The connection is unknown, preflights are skipped")
+    return
+  }
+  env, inputs, known := planEnv(&config, &state)
+  if !known {
+    tflog.Info(ctx, "Some inputs are unknown, preflights are skipped")
+    return
+  }
+
+  // Preflights are a set, run in a stable order, without reordering the configuration
+  preflights := append([]resourceCommandPreflightModel(nil), config.Preflight...)
+  sort.SliceStable(preflights, func(i, j int) bool {
+    return preflights[i].Cmd < preflights[j].Cmd
+  })
+
+  for _, preflight := range preflights {
+    runner := r.runner("preflight", state.Id).withDelivery(config.delivery(inputs, previous)).withOutputLimit(preflight.MaxOutputBytes)
+    runner.shell = sh
+    var result commandResult
+    ctx, result = runner.run(ctx, &resp.Diagnostics, preflight.Cmd, env, nil)
+    if result.Err != nil {
+      resp.Diagnostics.Append(runner.commandError(ctx, path.Root("preflight"), "Preflight failed", preflight.Cmd, result))
+    }
+  }
+}
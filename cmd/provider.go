@@ -3,7 +3,9 @@ package cmd
 import (
 	"context"
 	//"fmt"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	//"github.com/hashicorp/terraform-plugin-framework/path"
@@ -43,6 +45,29 @@ type providerCmd struct {
 // providerData can be used to store data from the Terraform configuration.
 type providerCmdModel struct {
 	Example types.String `tfsdk:"example"`
+	DiagnosticOutputSize types.Int64 `tfsdk:"diagnostic_output_size"`
+	DiagnosticLogDir types.String `tfsdk:"diagnostic_log_dir"`
+	HeartbeatInterval types.Int64 `tfsdk:"heartbeat_interval"`
+	MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
+}
+
+// providerCmdData holds the provider options shared with the resources and data sources.
+type providerCmdData struct {
+	// DiagnosticOutputSize is the maximum number of bytes of stdout and stderr shown in error diagnostics
+	DiagnosticOutputSize int
+	// DiagnosticLogDir is the directory where the full output of failed commands is written
+	DiagnosticLogDir string
+	// HeartbeatInterval is the period of the logs of silent commands (0 disables them)
+	HeartbeatInterval time.Duration
+	// MaxOutputBytes is the size of each output of a command kept in memory (0 for no limit)
+	MaxOutputBytes int
+}
+
+var defaultProviderCmdData = providerCmdData{
+	DiagnosticOutputSize: 4096,
+	DiagnosticLogDir: "",
+	HeartbeatInterval: 0,
+	MaxOutputBytes: 0,
 }
 
 func New() provider.Provider {
@@ -63,6 +88,35 @@ func (p *providerCmd) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Diagnos
         Optional:            true,
         Type:                types.StringType,
       },
+      "diagnostic_output_size": {
+        MarkdownDescription: "Maximum number of bytes of stdout and stderr shown in the diagnostics of failed commands. Longer outputs are truncated to their last bytes, and written in full into a log file (default: 4096)",
+        Optional:            true,
+        Type:                types.Int64Type,
+        Validators: []tfsdk.AttributeValidator{
+          int64validator.AtLeast(1),
+        },
+      },
+      "diagnostic_log_dir": {
+        MarkdownDescription: "Directory where the full output of failed commands is written. Only the 30 most recent log files are kept (default: the temporary directory)",
+        Optional:            true,
+        Type:                types.StringType,
+      },
+      "heartbeat_interval": {
+        MarkdownDescription: "Period, in seconds, of the logs reporting that a command is still running while it prints nothing (default: 0, which disables them)",
+        Optional:            true,
+        Type:                types.Int64Type,
+        Validators: []tfsdk.AttributeValidator{
+          int64validator.AtLeast(0),
+        },
+      },
+      "max_output_bytes": {
+        MarkdownDescription: "Size of each output (stdout, stderr, combined) of a command kept in memory; beyond it, only its head and tail are kept, and the full output is spilled into a temporary file removed once the command is done. The full output of a failed command is written into `diagnostic_log_dir` (default: 0, which disables the limit). Can be overridden by every command block",
+        Optional:            true,
+        Type:                types.Int64Type,
+        Validators: []tfsdk.AttributeValidator{
+          int64validator.AtLeast(0),
+        },
+      },
     },
   }, nil
 }
@@ -88,6 +142,22 @@ func (p *providerCmd) Configure(ctx context.Context, req provider.ConfigureReque
 	// If the upstream provider SDK or HTTP client requires configuration, such
 	// as authentication or logging, this is a great opportunity to do so.
 
+	data := defaultProviderCmdData
+	if !config.DiagnosticOutputSize.IsNull() {
+		data.DiagnosticOutputSize = int(config.DiagnosticOutputSize.ValueInt64())
+	}
+	if !config.DiagnosticLogDir.IsNull() {
+		data.DiagnosticLogDir = config.DiagnosticLogDir.ValueString()
+	}
+	if !config.HeartbeatInterval.IsNull() {
+		data.HeartbeatInterval = time.Duration(config.HeartbeatInterval.ValueInt64()) * time.Second
+	}
+	if !config.MaxOutputBytes.IsNull() {
+		data.MaxOutputBytes = int(config.MaxOutputBytes.ValueInt64())
+	}
+	resp.DataSourceData = &data
+	resp.ResourceData = &data
+
 	p.configured = true
 }
 
@@ -98,6 +168,7 @@ func (p *providerCmd) DataSources(_ context.Context) []func() datasource.DataSou
       return &dataSourceCommand{
         shell: nil,
         shellFactory: factory,
+        options: defaultProviderCmdData,
       }
     }
   })
@@ -110,6 +181,7 @@ func (p *providerCmd) Resources(_ context.Context) []func() resource.Resource {
       return &resourceCommand{
         shell: nil,
         shellFactory: factory,
+        options: defaultProviderCmdData,
       }
     }
   })
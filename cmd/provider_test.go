@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"testing"
 
-	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
 	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 )
 
 // testAccProtoV6ProviderFactories are used to instantiate a provider during
@@ -12,9 +14,7 @@ import (
 // CLI command executed to create a provider server to which the CLI can
 // reattach.
 var testAccProtoV6ProviderFactories = map[string]func() (tfprotov6.ProviderServer, error){
-	"scaffolding": func() (tfprotov6.ProviderServer, error) {
-		return tfsdk.NewProtocol6Server(New("test")()), nil
-	},
+	"cmd": providerserver.NewProtocol6WithError(New()),
 }
 
 func testAccPreCheck(t *testing.T) {
@@ -22,3 +22,40 @@ func testAccPreCheck(t *testing.T) {
 	// about the appropriate environment variables being set are common to see in a pre-check
 	// function.
 }
+
+func TestProviderConfigValidation(t *testing.T) {
+	ctx := context.Background()
+	server := providerserver.NewProtocol6(New())()
+	schema, err := server.GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerType := schema.Provider.ValueType().(tftypes.Object)
+	tests := []struct {
+		name    string
+		attrs   map[string]tftypes.Value
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "diagnostic output size", attrs: map[string]tftypes.Value{"diagnostic_output_size": tftypes.NewValue(tftypes.Number, 1)}},
+		{name: "empty diagnostic output", attrs: map[string]tftypes.Value{"diagnostic_output_size": tftypes.NewValue(tftypes.Number, 0)}, wantErr: true},
+		{name: "no output limit", attrs: map[string]tftypes.Value{"max_output_bytes": tftypes.NewValue(tftypes.Number, 0)}},
+		{name: "negative output limit", attrs: map[string]tftypes.Value{"max_output_bytes": tftypes.NewValue(tftypes.Number, -1)}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := tfprotov6.NewDynamicValue(providerType, testObject(providerType, test.attrs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := server.ValidateProviderConfig(ctx, &tfprotov6.ValidateProviderConfigRequest{Config: &config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if errors := testErrors(resp.Diagnostics); (len(errors) > 0) != test.wantErr {
+				t.Errorf("got errors %v, want errors: %t", errors, test.wantErr)
+			}
+		})
+	}
+}
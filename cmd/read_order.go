@@ -0,0 +1,141 @@
+package cmd
+
+import (
+  "context"
+  "fmt"
+  "sort"
+  "strings"
+
+  "github.com/hashicorp/terraform-plugin-framework/attr"
+  "github.com/hashicorp/terraform-plugin-framework/tfsdk"
+)
+
+// sortReads orders the read blocks so that every read comes after the reads it depends on.
+// Independent reads are ordered by name. An error is returned if dependencies form a cycle.
+func sortReads(reads []resourceCommandReadModel) ([]resourceCommandReadModel, error) {
+  byName := make(map[string]resourceCommandReadModel)
+  for _, read := range reads {
+    byName[read.Name] = read
+  }
+
+  remaining := make(map[string]int)
+  dependents := make(map[string][]string)
+  for _, read := range reads {
+    for _, dep := range read.DependsOnReads {
+      if _, found := byName[dep]; !found {
+        continue
+      }
+      remaining[read.Name] += 1
+      dependents[dep] = append(dependents[dep], read.Name)
+    }
+  }
+
+  var ready []string
+  for name := range byName {
+    if remaining[name] == 0 {
+      ready = append(ready, name)
+    }
+  }
+
+  sorted := make([]resourceCommandReadModel, 0, len(byName))
+  for len(ready) > 0 {
+    sort.Strings(ready)
+    name := ready[0]
+    ready = ready[1:]
+    sorted = append(sorted, byName[name])
+    for _, dependent := range dependents[name] {
+      remaining[dependent] -= 1
+      if remaining[dependent] == 0 {
+        ready = append(ready, dependent)
+      }
+    }
+  }
+
+  if len(sorted) < len(byName) {
+    var cycle []string
+    for name, n := range remaining {
+      if n > 0 {
+        cycle = append(cycle, name)
+      }
+    }
+    sort.Strings(cycle)
+    return nil, fmt.Errorf("Reads %s have cyclic dependencies", strings.Join(cycle, ", "))
+  }
+
+  return sorted, nil
+}
+
+// readDependents lists the reads that depend, directly or transitively, on the given variables.
+func readDependents(reads []resourceCommandReadModel, variables []string) []string {
+  type void struct{}
+  seen := make(map[string]void)
+  for _, v := range variables {
+    seen[v] = void{}
+  }
+
+  var dependents []string
+  for changed := true; changed; {
+    changed = false
+    for _, read := range reads {
+      if _, found := seen[read.Name]; found {
+        continue
+      }
+      for _, dep := range read.DependsOnReads {
+        if _, found := seen[dep]; found {
+          seen[read.Name] = void{}
+          dependents = append(dependents, read.Name)
+          changed = true
+          break
+        }
+      }
+    }
+  }
+
+  return dependents
+}
+
+// configuredReads decodes the read blocks of a configuration for their validators.
+// It returns false while some of their values are not known yet: conversion fails then, and they are validated again once known.
+func configuredReads(ctx context.Context, config attr.Value) ([]resourceCommandReadModel, bool) {
+  if config.IsUnknown() || config.IsNull() {
+    return nil, false
+  }
+  var reads []resourceCommandReadModel
+  if diags := tfsdk.ValueAs(ctx, config, &reads); diags.HasError() {
+    return nil, false
+  }
+  return reads, true
+}
+
+type readDependencyValidator struct {}
+
+func (_ readDependencyValidator) Description(ctx context.Context) string {
+  return "Validates the dependencies between read blocks"
+}
+func (_ readDependencyValidator) MarkdownDescription(ctx context.Context) string {
+  return "Validates the dependencies between read blocks"
+}
+func (_ readDependencyValidator) Validate(ctx context.Context, req tfsdk.ValidateAttributeRequest, resp *tfsdk.ValidateAttributeResponse) {
+  reads, ok := configuredReads(ctx, req.AttributeConfig)
+  if !ok {
+    return
+  }
+
+  type void struct{}
+  names := make(map[string]void)
+  for _, read := range reads {
+    names[read.Name] = void{}
+  }
+
+  for _, read := range reads {
+    for _, dep := range read.DependsOnReads {
+      if _, found := names[dep]; !found {
+        resp.Diagnostics.AddError("Invalid read dependency", fmt.Sprintf("Read %s depends on %s, but there is no read block with such a name.", read.Name, dep))
+      }
+    }
+  }
+
+  if _, err := sortReads(reads); err != nil {
+    resp.Diagnostics.AddError("Invalid read dependency", fmt.Sprintf("%s", err))
+  }
+}
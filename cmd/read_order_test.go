@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+func TestSortReads(t *testing.T) {
+	read := func(name string, deps ...string) resourceCommandReadModel {
+		return resourceCommandReadModel{Name: name, DependsOnReads: deps}
+	}
+	tests := []struct {
+		name    string
+		reads   []resourceCommandReadModel
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "no reads",
+			reads: nil,
+			want:  []string{},
+		},
+		{
+			name:  "independent reads by name",
+			reads: []resourceCommandReadModel{read("c"), read("a"), read("b")},
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			name:  "chain",
+			reads: []resourceCommandReadModel{read("a", "b"), read("b", "c"), read("c")},
+			want:  []string{"c", "b", "a"},
+		},
+		{
+			name:  "diamond",
+			reads: []resourceCommandReadModel{read("d", "b", "c"), read("c", "a"), read("b", "a"), read("a")},
+			want:  []string{"a", "b", "c", "d"},
+		},
+		{
+			name:  "dependencies before names",
+			reads: []resourceCommandReadModel{read("a", "z"), read("b"), read("z")},
+			want:  []string{"b", "z", "a"},
+		},
+		{
+			name:  "unknown dependency",
+			reads: []resourceCommandReadModel{read("a", "missing"), read("b")},
+			want:  []string{"a", "b"},
+		},
+		{
+			name:    "self dependency",
+			reads:   []resourceCommandReadModel{read("a", "a"), read("b")},
+			wantErr: "Reads a have cyclic dependencies",
+		},
+		{
+			name:    "cycle",
+			reads:   []resourceCommandReadModel{read("a", "c"), read("b", "a"), read("c", "b"), read("d")},
+			wantErr: "Reads a, b, c have cyclic dependencies",
+		},
+		{
+			name:    "dependent of a cycle",
+			reads:   []resourceCommandReadModel{read("a", "b"), read("b", "a"), read("c", "a")},
+			wantErr: "Reads a, b, c have cyclic dependencies",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sorted, err := sortReads(test.reads)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			names := []string{}
+			for _, read := range sorted {
+				names = append(names, read.Name)
+			}
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("got %v, want %v", names, test.want)
+			}
+		})
+	}
+}
+
+func TestReadDependents(t *testing.T) {
+	reads := []resourceCommandReadModel{
+		{Name: "a"},
+		{Name: "b", DependsOnReads: []string{"a"}},
+		{Name: "c", DependsOnReads: []string{"b"}},
+		{Name: "d"},
+		{Name: "e", DependsOnReads: []string{"d", "c"}},
+	}
+	tests := []struct {
+		variables []string
+		want      []string
+	}{
+		{variables: nil, want: nil},
+		{variables: []string{"a"}, want: []string{"b", "c", "e"}},
+		{variables: []string{"d"}, want: []string{"e"}},
+		{variables: []string{"e"}, want: nil},
+	}
+
+	for _, test := range tests {
+		got := readDependents(reads, test.variables)
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("readDependents(%v) = %v, want %v", test.variables, got, test.want)
+		}
+	}
+}
+
+func TestReadDependencyValidator(t *testing.T) {
+	r := newTestResource(t)
+	depsType := r.typ.AttributeTypes["read"].(tftypes.Set).ElementType.(tftypes.Object).AttributeTypes["depends_on_reads"]
+	deps := func(names ...string) tftypes.Value {
+		var values []tftypes.Value
+		for _, name := range names {
+			values = append(values, testString(name))
+		}
+		return tftypes.NewValue(depsType, values)
+	}
+	tests := []struct {
+		name    string
+		reads   []map[string]tftypes.Value
+		wantErr string
+	}{
+		{
+			name: "valid",
+			reads: []map[string]tftypes.Value{
+				{"name": testString("a"), "cmd": testString("echo"), "depends_on_reads": deps("b")},
+				{"name": testString("b"), "cmd": testString("echo")},
+			},
+		},
+		{
+			name: "unknown read",
+			reads: []map[string]tftypes.Value{
+				{"name": testString("a"), "cmd": testString("echo"), "depends_on_reads": deps("b")},
+			},
+			wantErr: "Invalid read dependency: Read a depends on b, but there is no read block with such a name.",
+		},
+		{
+			name: "cycle",
+			reads: []map[string]tftypes.Value{
+				{"name": testString("a"), "cmd": testString("echo"), "depends_on_reads": deps("b")},
+				{"name": testString("b"), "cmd": testString("echo"), "depends_on_reads": deps("a")},
+			},
+			wantErr: "Invalid read dependency: Reads a, b have cyclic dependencies",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errors := testErrors(r.validate(r.config(nil, map[string][]map[string]tftypes.Value{"read": test.reads})))
+			if test.wantErr == "" && len(errors) > 0 {
+				t.Errorf("unexpected errors: %v", errors)
+			}
+			if test.wantErr != "" && (len(errors) != 1 || errors[0] != test.wantErr) {
+				t.Errorf("got %v, want %q", errors, test.wantErr)
+			}
+		})
+	}
+}
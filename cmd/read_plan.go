@@ -0,0 +1,198 @@
+package cmd
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "sort"
+
+  "github.com/hashicorp/terraform-plugin-framework/diag"
+  "github.com/hashicorp/terraform-plugin-framework/path"
+  "github.com/hashicorp/terraform-plugin-framework/resource"
+  "github.com/hashicorp/terraform-plugin-framework/types"
+  "github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// predictionsKey is the key of the private state listing the state variables predicted by the plan of an update.
+const predictionsKey = "predictions"
+
+// planShell returns the shell running a command at plan time, or nil if the connection is not fully known yet.
+func (r *resourceCommand) planShell(ctx context.Context, config resourceCommandModel, local bool) (shell, diag.Diagnostics) {
+  if local {
+    return shellLocalFactory.Create(ctx, types.Object{})
+  }
+  // A known connection may still have unknown attributes, like the address of a host being created
+  if connection, err := config.ConnectionOptions.ToTerraformValue(ctx); err != nil || !connection.IsFullyKnown() {
+    return nil, nil
+  }
+  if d := r.init(ctx, config); len(d) > 0 {
+    return nil, d
+  }
+  return r.shell, nil
+}
+
+// planEnv returns the environment of the commands run at plan time, and the decoded inputs.
+// It returns false if some inputs are not known yet.
+func planEnv(config *resourceCommandModel, state *resourceCommandModel) (map[string]string, map[string]string, bool) {
+  if config.TypedInputs.IsUnknown() {
+    return nil, nil, false
+  }
+  for _, input := range config.inputs() {
+    if input.IsUnknown() {
+      return nil, nil, false
+    }
+  }
+  inputs, diags := config.inputValues()
+  if diags.HasError() {
+    return nil, nil, false
+  }
+
+  env := make(map[string]string)
+  for k, v := range inputs {
+    env[fmt.Sprintf("INPUT_%s", k)] = v
+  }
+  for k, v := range state.states() {
+    env[fmt.Sprintf("STATE_%s", k)] = v.ValueString()
+  }
+  return env, inputs, true
+}
+
+// predictStates predicts the values of the state variables reloaded by the plan, with the plan blocks of their reads.
+func (r *resourceCommand) predictStates(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+  var config, state resourceCommandModel
+  var previous *resourceCommandModel
+  resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+  if !req.State.Raw.IsNull() && req.State.Raw.IsKnown() {
+    resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+    previous = &state
+  }
+  plannedState := map[string]types.String{}
+  plannedSensitiveState := map[string]types.String{}
+  resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("state"), &plannedState)...)
+  resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("sensitive_state"), &plannedSensitiveState)...)
+  if resp.Diagnostics.HasError() {
+    return
+  }
+
+  predicted := []string{}
+  defer func() {
+    if !req.State.Raw.IsNull() {
+      value, _ := json.Marshal(predicted)
+      resp.Diagnostics.Append(resp.Private.SetKey(ctx, predictionsKey, value)...)
+    }
+  }()
+
+  // Predictions need every input
+  env, inputs, known := planEnv(&config, &state)
+  if !known {
+    tflog.Info(ctx, "Some inputs are unknown, no state variable is predicted")
+    return
+  }
+  planned := mergeMaps(plannedState, plannedSensitiveState)
+
+  for _, read := range config.Read {
+    if len(read.Plan) == 0 {
+      continue
+    }
+    if value, found := planned[read.Name]; !found || !value.IsUnknown() {
+      continue
+    }
+    plan := read.Plan[0]
+
+    sh, diags := r.planShell(ctx, config, plan.Local.ValueBool())
+    resp.Diagnostics.Append(diags...)
+    if diags.HasError() {
+      return
+    }
+    if sh == nil {
+      tflog.Info(ctx, fmt.Sprintf("The connection is unknown, %s is not predicted", read.Name))
+      continue
+    }
+
+    readEnv := mergeMaps(env)
+    for _, dep := range read.DependsOnReads {
+      if value, found := planned[dep]; found && !value.IsNull() && !value.IsUnknown() {
+        readEnv[fmt.Sprintf("READ_%s", dep)] = value.ValueString()
+      }
+    }
+
+    runner := r.runner("plan", state.Id).withBlock("read." + read.Name + ".plan").withCapture(read.Capture.ValueString(), read.Encoding.ValueString()).withDelivery(config.delivery(inputs, previous)).withOutputLimit(read.MaxOutputBytes)
+    runner.shell = sh
+    runner.logStdout = false
+    var result commandResult
+    ctx, result = runner.run(ctx, &resp.Diagnostics, plan.Cmd, readEnv, nil)
+    var value string
+    err := result.Err
+    if err == nil {
+      value, err = captureOutput(read.Capture.ValueString(), result)
+    }
+    if err == nil {
+      value, err = encodeOutput(read.Encoding.ValueString(), value)
+    }
+    if err != nil {
+      resp.Diagnostics.AddAttributeWarning(path.Root("read"), fmt.Sprintf("Unable to predict %s", read.Name), redact(ctx, fmt.Sprintf("%s\n\nIts value is known after apply.", err)))
+      continue
+    }
+
+    if _, found := plannedState[read.Name]; found {
+      plannedState[read.Name] = types.StringValue(value)
+    } else {
+      // The value is masked from the next plan commands, which may print it as READ_<name>
+      ctx = addSecrets(ctx, value)
+      plannedSensitiveState[read.Name] = types.StringValue(value)
+    }
+    planned[read.Name] = types.StringValue(value)
+    predicted = append(predicted, read.Name)
+  }
+
+  resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("state"), plannedState)...)
+  resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("sensitive_state"), plannedSensitiveState)...)
+}
+
+// predictions returns the values predicted at plan time for the given state variables.
+// Unknown values have not been predicted.
+func (data *resourceCommandModel) predictions(names []string) map[string]types.String {
+  predictions := make(map[string]types.String)
+  states := data.states()
+  for _, name := range names {
+    if value, found := states[name]; found && !value.IsUnknown() {
+      predictions[name] = value
+    }
+  }
+  return predictions
+}
+
+// storedPredictions returns the names of the state variables predicted by the plan of an update.
+func storedPredictions(ctx context.Context, private privateGetter) ([]string, diag.Diagnostics) {
+  stored, diags := private.GetKey(ctx, predictionsKey)
+  if diags.HasError() || len(stored) == 0 {
+    return nil, diags
+  }
+  var names []string
+  if err := json.Unmarshal(stored, &names); err != nil {
+    diags.AddError("Unable to read predictions", err.Error())
+  }
+  return names, diags
+}
+
+// verifyPredictions checks that the values read after apply match their predictions at plan time.
+// Values are not shown, as they may be sensitive.
+func (data *resourceCommandModel) verifyPredictions(predictions map[string]types.String) diag.Diagnostics {
+  var diags diag.Diagnostics
+  states := data.states()
+  names := make([]string, 0, len(predictions))
+  for name := range predictions {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  for _, name := range names {
+    if value, found := states[name]; !found || !value.Equal(predictions[name]) {
+      diags.AddAttributeError(
+        path.Root("read"),
+        "Wrong prediction",
+        fmt.Sprintf("The value of %s read after apply differs from the one predicted by its plan block.", name),
+      )
+    }
+  }
+  return diags
+}
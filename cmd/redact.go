@@ -0,0 +1,162 @@
+package cmd
+
+import (
+  "context"
+  "sort"
+  "strings"
+  "sync"
+
+  "github.com/hashicorp/terraform-plugin-go/tftypes"
+  "github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// sensitiveAttributes lists the attributes whose values must not appear in the logs nor in the diagnostics.
+var sensitiveAttributes = []string{"sensitive_inputs", "sensitive_state"}
+
+// sensitiveBlockAttributes lists the attributes of the command blocks whose values must not appear in the logs nor in the diagnostics.
+var sensitiveBlockAttributes = []string{"stdin"}
+
+// redactor holds the secrets of an operation.
+// It is stored in the context so that logs and diagnostics can be redacted anywhere.
+type redactor struct {
+  // mutex protects the secrets registered while streaming both stdout and stderr
+  mutex sync.Mutex
+  secrets []string
+  known map[string]struct{}
+}
+
+type redactorKey struct{}
+
+// minSecretLength is the length under which values are not masked, as short values like `1` or `true`
+// would otherwise be masked everywhere they appear, making the logs unreadable.
+const minSecretLength = 4
+
+// maskedKey stores in the context how many secrets of the redactor are already masked in the logs.
+type maskedKey struct{}
+
+// addSecrets registers secrets that are masked from now on in the logs and redacted from the diagnostics.
+// Without secrets, it masks in the logs of the returned context the secrets registered with another context.
+// Secrets are registered without their trailing newline, that outputs captured as values usually end with.
+// Secrets shorter than minSecretLength are ignored.
+func addSecrets(ctx context.Context, secrets ...string) context.Context {
+  r, ok := ctx.Value(redactorKey{}).(*redactor)
+  if !ok {
+    r = &redactor{
+      known: make(map[string]struct{}),
+    }
+    ctx = context.WithValue(ctx, redactorKey{}, r)
+  }
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+  for _, secret := range secrets {
+    secret = strings.TrimRight(secret, "\r\n")
+    if len(secret) < minSecretLength {
+      continue
+    }
+    if _, found := r.known[secret]; !found {
+      r.known[secret] = struct{}{}
+      r.secrets = append(r.secrets, secret)
+    }
+  }
+
+  masked, _ := ctx.Value(maskedKey{}).(int)
+  if masked == len(r.secrets) {
+    return ctx
+  }
+  ctx = tflog.MaskLogStrings(ctx, r.secrets[masked:]...)
+  return context.WithValue(ctx, maskedKey{}, len(r.secrets))
+}
+
+// redact replaces all the secrets of the context found in s.
+func redact(ctx context.Context, s string) string {
+  r, ok := ctx.Value(redactorKey{}).(*redactor)
+  if !ok {
+    return s
+  }
+  r.mutex.Lock()
+  secrets := append([]string(nil), r.secrets...)
+  r.mutex.Unlock()
+  // Longest secrets first, so that secrets containing other secrets are fully redacted
+  sort.Slice(secrets, func(i, j int) bool {
+    return len(secrets[i]) > len(secrets[j])
+  })
+  for _, secret := range secrets {
+    s = strings.ReplaceAll(s, secret, "***")
+  }
+  return s
+}
+
+// sensitiveConnectionAttributes lists the sensitive connection options of all the shells.
+func sensitiveConnectionAttributes() map[string]struct{} {
+  attributes := make(map[string]struct{})
+  for _, factory := range shellFactories {
+    for name, attribute := range factory.Schema {
+      if attribute.Sensitive {
+        attributes[name] = struct{}{}
+      }
+    }
+  }
+  return attributes
+}
+
+// collectBlockStrings collects the strings of the given attributes of every element of a block.
+func collectBlockStrings(block tftypes.Value, names []string, out *[]string) {
+  if block.IsNull() || !block.IsKnown() || !(block.Type().Is(tftypes.List{}) || block.Type().Is(tftypes.Set{})) {
+    return
+  }
+  var elems []tftypes.Value
+  if err := block.As(&elems); err != nil {
+    return
+  }
+  for _, elem := range elems {
+    if elem.IsNull() || !elem.IsKnown() || !elem.Type().Is(tftypes.Object{}) {
+      continue
+    }
+    var attrs map[string]tftypes.Value
+    if err := elem.As(&attrs); err != nil {
+      continue
+    }
+    for _, name := range names {
+      if attr, found := attrs[name]; found {
+        collectStrings(attr, out)
+      }
+    }
+  }
+}
+
+// maskSensitive returns a context masking the values of the sensitive attributes of the given resources or data sources.
+func maskSensitive(ctx context.Context, vals ...tftypes.Value) context.Context {
+  var secrets []string
+  for _, val := range vals {
+    if val.IsNull() || !val.IsKnown() || !val.Type().Is(tftypes.Object{}) {
+      continue
+    }
+    var attrs map[string]tftypes.Value
+    if err := val.As(&attrs); err != nil {
+      continue
+    }
+    for _, name := range sensitiveAttributes {
+      if attr, found := attrs[name]; found {
+        collectStrings(attr, &secrets)
+      }
+    }
+    for _, attr := range attrs {
+      collectBlockStrings(attr, sensitiveBlockAttributes, &secrets)
+    }
+
+    connection, found := attrs["connection"]
+    if !found || connection.IsNull() || !connection.IsKnown() {
+      continue
+    }
+    var options map[string]tftypes.Value
+    if err := connection.As(&options); err != nil {
+      continue
+    }
+    for name := range sensitiveConnectionAttributes() {
+      if option, found := options[name]; found {
+        collectStrings(option, &secrets)
+      }
+    }
+  }
+  return addSecrets(ctx, secrets...)
+}
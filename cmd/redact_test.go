@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+func TestMaskSensitive(t *testing.T) {
+	r := newTestResource(t)
+	config := r.config(
+		map[string]tftypes.Value{
+			"inputs":           tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{"public": testString("visible")}),
+			"sensitive_inputs": tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{"password": testString("hunter2")}),
+		},
+		map[string][]map[string]tftypes.Value{
+			"create": {{"cmd": testString("cat"), "stdin": testString("create-secret")}},
+			"read":   {{"name": testString("a"), "cmd": testString("cat"), "stdin": testString("read-secret")}},
+		},
+	)
+
+	ctx := maskSensitive(context.Background(), config)
+	got := redact(ctx, "visible hunter2 create-secret read-secret")
+	if want := "visible *** *** ***"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAddSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		input   string
+		want    string
+	}{
+		{name: "secret", secrets: []string{"hunter2"}, input: "password: hunter2", want: "password: ***"},
+		{name: "empty secret", secrets: []string{""}, input: "password: ", want: "password: "},
+		{name: "short secrets", secrets: []string{"1", "ok", "yes"}, input: "1 ok yes", want: "1 ok yes"},
+		{name: "trailing newline", secrets: []string{"hunter2\n"}, input: "password: hunter2", want: "password: ***"},
+		{name: "short secret with a newline", secrets: []string{"abc\n"}, input: "abc\n", want: "abc\n"},
+		{name: "shortest secret", secrets: []string{"true"}, input: "is true", want: "is ***"},
+		{name: "secret containing another one", secrets: []string{"pass", "password"}, input: "password pass", want: "*** ***"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := addSecrets(context.Background(), test.secrets...)
+			if got := redact(ctx, test.input); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
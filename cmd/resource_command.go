@@ -2,6 +2,7 @@ package cmd
 
 import (
   "context"
+  "crypto/sha256"
   "strings"
   "sort"
   "fmt"
@@ -26,12 +27,14 @@ var (
 	_ resource.Resource                = &resourceCommand{}
 	_ resource.ResourceWithConfigure   = &resourceCommand{}
 	_ resource.ResourceWithImportState = &resourceCommand{}
+	_ resource.ResourceWithModifyPlan  = &resourceCommand{}
 )
 
 // resourceCommand is a resource handle to a cmd_local resource.
 type resourceCommand struct {
   shell shell
   shellFactory shellFactory
+  options providerCmdData
 }
 
 // Metadata returns the data source type name.
@@ -59,14 +62,100 @@ func (r *resourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Dia
         },
         Type: types.MapType{types.StringType},
       },
+      "typed_inputs": {
+        Optional:            true,
+        MarkdownDescription: "Inputs of any type: numbers, bools, lists and nested objects. Scalars are exported as strings, and structured inputs both as JSON and flattened into variables like `INPUT_users_0_name`, which must not collide with one another. Update triggers can refer to nested inputs like `users.*`",
+        PlanModifiers: tfsdk.AttributePlanModifiers{
+          inputPlanModifier{},
+        },
+        Type: dynamicType{},
+        Validators: []tfsdk.AttributeValidator{
+          typedInputsValidator{},
+        },
+      },
+      "sensitive_inputs": {
+        Optional:            true,
+        Sensitive:           true,
+        MarkdownDescription: "Sensitive inputs. They behave exactly like `inputs`, but are hidden from the plan and the logs",
+        PlanModifiers: tfsdk.AttributePlanModifiers{
+          inputPlanModifier{},
+        },
+        Validators: []tfsdk.AttributeValidator{
+          sensitiveInputsValidator{},
+        },
+        Type: types.MapType{types.StringType},
+      },
       "state": {
         Computed:            true,
         MarkdownDescription: "State",
         PlanModifiers: tfsdk.AttributePlanModifiers{
-          statePlanModifier{},
+          statePlanModifier{sensitive: false},
         },
         Type: types.MapType{types.StringType},
       },
+      "sensitive_state": {
+        Computed:            true,
+        Sensitive:           true,
+        MarkdownDescription: "Sensitive state, holding the variables of the sensitive read and outputs blocks",
+        PlanModifiers: tfsdk.AttributePlanModifiers{
+          statePlanModifier{sensitive: true},
+        },
+        Type: types.MapType{types.StringType},
+      },
+      "input_encodings": inputEncodingsAttribute(),
+      "input_delivery": {
+        Optional:            true,
+        MarkdownDescription: "How inputs are given to the commands: `env` exports `INPUT_<name>` (and `PREVIOUS_<name>` during updates) variables, `files` writes every input into a file of the directory `$INPUT_DIR`, and `json` writes the inputs, the previous inputs and the state into the JSON file `$CONTEXT_JSON` (default: `[\"env\"]`). Files are removed once the command is done",
+        Type: types.SetType{types.StringType},
+        Validators: []tfsdk.AttributeValidator{
+          setvalidator.ValuesAre(stringvalidator.OneOf(inputDeliveries...)),
+        },
+      },
+      "update_strategy": {
+        Optional:            true,
+        MarkdownDescription: "How update rules are selected when inputs change: `minimal` (default) runs the single rule whose triggers are the smallest superset of the modified inputs, whereas `compose` runs every rule whose triggers match some modified input, by `priority`. The rule without triggers only runs for the modified inputs no other rule matches. Without any rule to run, the resource is replaced",
+        Type: types.StringType,
+        Validators: []tfsdk.AttributeValidator{
+          stringvalidator.OneOf("minimal", "compose"),
+        },
+      },
+      "replace_on": {
+        Optional:            true,
+        MarkdownDescription: "Inputs whose modification replaces the resource, even if an update rule matches them. Like update triggers, they can be nested paths, globs or regexes. It takes precedence over `ignore_changes_of`",
+        Type: types.SetType{types.StringType},
+        Validators: []tfsdk.AttributeValidator{
+          setvalidator.ValuesAre(triggerPatternValidator{}),
+        },
+      },
+      "ignore_changes_of": {
+        Optional:            true,
+        MarkdownDescription: "Inputs whose modification is stored in the state without running any update command nor replacing the resource. Like update triggers, they can be nested paths, globs or regexes",
+        Type: types.SetType{types.StringType},
+        Validators: []tfsdk.AttributeValidator{
+          setvalidator.ValuesAre(triggerPatternValidator{}),
+        },
+      },
+      "on_command_change": {
+        Optional:            true,
+        MarkdownDescription: "What happens when the commands of the create, update or destroy blocks are modified: `replace` the resource, run every `update` rule, or `ignore` the modification until the next operation (default). Hashes of the commands are kept in the private state",
+        Type: types.StringType,
+        Validators: []tfsdk.AttributeValidator{
+          stringvalidator.OneOf(onCommandChanges...),
+        },
+      },
+      "planned_action": {
+        Computed:            true,
+        MarkdownDescription: "What the last plan does with the resource and why: `create`, `update:` followed by the modified inputs and commands, the update rules to run and the state variables to reload, or `replace:` followed by the reason of the replacement. A replacement is also explained by a warning, as Terraform shows the plan of the new resource",
+        PlanModifiers: tfsdk.AttributePlanModifiers{
+          plannedActionModifier{},
+        },
+        Type: types.StringType,
+      },
+      "detect_drift": {
+        Optional:            true,
+        MarkdownDescription: "During a refresh, inputs are overwritten by the result of the read blocks with the same name, so that their drift is reconciled by an update (default: false)",
+        Type: types.BoolType,
+      },
       "id": {
         Computed:            true,
         MarkdownDescription: "Example identifier",
@@ -79,17 +168,25 @@ func (r *resourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Dia
 
     Blocks: map[string]tfsdk.Block{
       "update": {
+        PlanModifiers: tfsdk.AttributePlanModifiers{
+          commandChangePlanModifier{operation: "update"},
+        },
         NestingMode: tfsdk.BlockNestingModeSet,
         Attributes: map[string]tfsdk.Attribute{
           "triggers": {
-            MarkdownDescription: "What variable changes trigger the update",
+            MarkdownDescription: "What variable changes trigger the update: input names or paths like `users.0.name`, globs like `user_*` or `users.*`, or regexes between slashes like `/user_(alice|bob)/`",
             Optional:            true,
             Type:                types.SetType{types.StringType},
             Validators: []tfsdk.AttributeValidator{
               setvalidator.SizeAtLeast(1),
-              setvalidator.ValuesAre(stringvalidator.RegexMatches(regexp.MustCompile(`^[a-zA-Z]\w*$`), "must start with a letter and contain only letters, digits and underscore")),
+              setvalidator.ValuesAre(triggerPatternValidator{}),
             },
           },
+          "priority": {
+            MarkdownDescription: "Order of the rules run together with `update_strategy = \"compose\"`: lower first (default: 0)",
+            Optional:            true,
+            Type:                types.Int64Type,
+          },
           "reloads": {
             MarkdownDescription: "What state variables must be reloaded",
             Optional:            true,
@@ -99,10 +196,14 @@ func (r *resourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Dia
             },
           },
           "cmd": {
-            MarkdownDescription: "Command to execute",
+            MarkdownDescription: "Command to execute. Besides `OPERATION`, it gets the space-separated lists of the modified inputs in `CHANGED_INPUTS`, `ADDED_INPUTS` and `REMOVED_INPUTS`, the triggers of the rule in `UPDATE_TRIGGERS`, and the operations whose commands are modified in `CHANGED_COMMANDS` (see `on_command_change`)",
             Required:            true,
             Type:                types.StringType,
           },
+          "exit_codes": exitCodesAttribute("`success`, `unchanged` to skip the reloading of the state, or `retry` to execute the command again. `absent` is a success"),
+          "max_output_bytes": maxOutputBytesAttribute(),
+          "stdin": stdinAttribute(),
+          "stdin_encoding": stdinEncodingAttribute(),
         },
         Validators: []tfsdk.AttributeValidator{
           updateAmbiguityValidator{},
@@ -125,9 +226,93 @@ func (r *resourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Dia
             Required:            true,
             Type:                types.StringType,
           },
+          "exit_codes": exitCodesAttribute("`success`, `unchanged` to keep the previous value, `absent` to remove the resource from the state during a refresh, or `retry` to execute the command again"),
+          "max_output_bytes": maxOutputBytesAttribute(),
+          "stdin": stdinAttribute(),
+          "stdin_encoding": stdinEncodingAttribute(),
+          "capture": captureAttribute(),
+          "encoding": encodingAttribute(),
+          "depends_on_reads": {
+            MarkdownDescription: "Read blocks that must be executed before this one. Their fresh values are available as `$READ_<name>`",
+            Optional:            true,
+            Type:                types.SetType{types.StringType},
+          },
+          "sensitive": {
+            MarkdownDescription: "Store the variable in `sensitive_state` instead of `state` (default: false)",
+            Optional:            true,
+            Type:                types.BoolType,
+          },
+          "on_error": {
+            MarkdownDescription: "What to do when the command fails: `fail` (default), `keep_previous` to keep the previous value, `null` to set the variable to null, or `default` to use the value of `default`",
+            Optional:            true,
+            Type:                types.StringType,
+            Validators: []tfsdk.AttributeValidator{
+              stringvalidator.OneOf("fail", "keep_previous", "null", "default"),
+            },
+          },
+          "default": {
+            MarkdownDescription: "Value of the variable when the command fails. Setting it implies `on_error = \"default\"`, which requires it",
+            Optional:            true,
+            Type:                types.StringType,
+          },
+        },
+        Blocks: map[string]tfsdk.Block{
+          "plan": {
+            NestingMode: tfsdk.BlockNestingModeList,
+            MaxItems:    1,
+            MarkdownDescription: "Command predicting the value of the variable at plan time, instead of leaving it unknown until apply. Its output is captured and encoded like the one of `cmd`, which must give the same value after apply",
+            Attributes: map[string]tfsdk.Attribute{
+              "cmd": {
+                MarkdownDescription: "Command to execute at plan time. It gets the planned inputs as `INPUT_<name>`, the current state as `STATE_<name>`, and `OPERATION=plan`",
+                Required:            true,
+                Type:                types.StringType,
+              },
+              "local": {
+                MarkdownDescription: "Run the command on the machine running Terraform rather than through the connection, which may not be known at plan time (default: false)",
+                Optional:            true,
+                Type:                types.BoolType,
+              },
+            },
+          },
+        },
+        Validators: []tfsdk.AttributeValidator{
+          readDependencyValidator{},
+          readOnErrorValidator{},
+        },
+      },
+      "outputs": {
+        NestingMode: tfsdk.BlockNestingModeSet,
+        MinItems: 0,
+        MaxItems: 1,
+        Attributes: map[string]tfsdk.Attribute{
+          "names": {
+            MarkdownDescription: "Variable names written by the command into the file `$STATE_OUTPUT`",
+            Required:            true,
+            Type:                types.SetType{types.StringType},
+            Validators: []tfsdk.AttributeValidator{
+              setvalidator.SizeAtLeast(1),
+              setvalidator.ValuesAre(stringvalidator.RegexMatches(regexp.MustCompile(`^[a-zA-Z]\w*$`), "must start with a letter and contain only letters, digits and underscore")),
+              outputsNameValidator{},
+            },
+          },
+          "sensitive": {
+            MarkdownDescription: "Store the variables in `sensitive_state` instead of `state` (default: false)",
+            Optional:            true,
+            Type:                types.BoolType,
+          },
+          "cmd": {
+            MarkdownDescription: "Command to execute. It must write `name=value` lines, `name<<DELIMITER` multiline values, or JSON objects into the file `$STATE_OUTPUT`",
+            Required:            true,
+            Type:                types.StringType,
+          },
+          "exit_codes": exitCodesAttribute("`success`, `unchanged` to keep the previous values, `absent` to remove the resource from the state during a refresh, or `retry` to execute the command again"),
+          "max_output_bytes": maxOutputBytesAttribute(),
         },
       },
       "create": {
+        PlanModifiers: tfsdk.AttributePlanModifiers{
+          commandChangePlanModifier{operation: "create"},
+        },
         NestingMode: tfsdk.BlockNestingModeSet,
         MinItems: 0,
         MaxItems: 1,
@@ -137,9 +322,16 @@ func (r *resourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Dia
             Required:            true,
             Type:                types.StringType,
           },
+          "exit_codes": exitCodesAttribute("`success` or `retry` to execute the command again. `unchanged` and `absent` are successes"),
+          "max_output_bytes": maxOutputBytesAttribute(),
+          "stdin": stdinAttribute(),
+          "stdin_encoding": stdinEncodingAttribute(),
         },
       },
       "destroy": {
+        PlanModifiers: tfsdk.AttributePlanModifiers{
+          commandChangePlanModifier{operation: "destroy"},
+        },
         NestingMode: tfsdk.BlockNestingModeSet,
         MinItems: 0,
         MaxItems: 1,
@@ -149,6 +341,47 @@ func (r *resourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Dia
             Required:            true,
             Type:                types.StringType,
           },
+          "exit_codes": exitCodesAttribute("`success`, `absent` if the resource is already destroyed, or `retry` to execute the command again. `unchanged` is a success"),
+          "max_output_bytes": maxOutputBytesAttribute(),
+          "stdin": stdinAttribute(),
+          "stdin_encoding": stdinEncodingAttribute(),
+        },
+      },
+      "preflight": {
+        NestingMode: tfsdk.BlockNestingModeSet,
+        MarkdownDescription: "Commands checking the prerequisites of the resource on its host when planning its creation or its update. The plan fails with their output if they exit with a non-zero status. They are skipped while the connection or the inputs are unknown",
+        Attributes: map[string]tfsdk.Attribute{
+          "cmd": {
+            MarkdownDescription: "Command to execute. It gets the planned inputs as `INPUT_<name>`, the current state as `STATE_<name>`, and `OPERATION=preflight`",
+            Required:            true,
+            Type:                types.StringType,
+          },
+          "max_output_bytes": maxOutputBytesAttribute(),
+        },
+      },
+      "check": {
+        NestingMode: tfsdk.BlockNestingModeSet,
+        MarkdownDescription: "Assertions on the resource run after its creation, its update and every refresh, like a health check. Unlike reads, they store nothing in the state",
+        Attributes: map[string]tfsdk.Attribute{
+          "cmd": {
+            MarkdownDescription: "Command to execute. It fails the check if it exits with a non-zero status. It gets the inputs as `INPUT_<name>` and the state as `STATE_<name>`",
+            Required:            true,
+            Type:                types.StringType,
+          },
+          "severity": {
+            MarkdownDescription: "How a failed check is reported: `warning`, or `error` (default). An error after a creation taints the resource",
+            Optional:            true,
+            Type:                types.StringType,
+            Validators: []tfsdk.AttributeValidator{
+              stringvalidator.OneOf(checkSeverities...),
+            },
+          },
+          "message": {
+            MarkdownDescription: "Message reported when the check fails, instead of the details of the command. Variables of the command written like `${INPUT_<name>}` or `${STATE_<name>}` are replaced by their value, as well as `${stdout}`, `${stderr}` and `${status}` by the outputs and the exit status of the command. Other dollar signs are kept as is",
+            Optional:            true,
+            Type:                types.StringType,
+          },
+          "max_output_bytes": maxOutputBytesAttribute(),
         },
       },
     },
@@ -157,34 +390,116 @@ func (r *resourceCommand) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Dia
 
 // Configure adds the provider configured client to the data source.
 func (r *resourceCommand) Configure(_ context.Context, req resource.ConfigureRequest, _ *resource.ConfigureResponse) {
+  if options, ok := req.ProviderData.(*providerCmdData); ok {
+    r.options = *options
+  }
 }
 
 // resourceCommandModel encodes the data of a cmd_local resource.
 type resourceCommandModel struct {
   Id   types.String `tfsdk:"id"`
   Input map[string]types.String `tfsdk:"inputs"`
+  SensitiveInput map[string]types.String `tfsdk:"sensitive_inputs"`
+  TypedInputs dynamicValue `tfsdk:"typed_inputs"`
   State map[string]types.String `tfsdk:"state"`
+  SensitiveState map[string]types.String `tfsdk:"sensitive_state"`
   ConnectionOptions types.Object `tfsdk:"connection"`
+  InputEncodings map[string]string `tfsdk:"input_encodings"`
+  InputDelivery []string `tfsdk:"input_delivery"`
+  UpdateStrategy types.String `tfsdk:"update_strategy"`
+  ReplaceOn []string `tfsdk:"replace_on"`
+  IgnoreChangesOf []string `tfsdk:"ignore_changes_of"`
+  OnCommandChange types.String `tfsdk:"on_command_change"`
+  PlannedAction types.String `tfsdk:"planned_action"`
+  DetectDrift types.Bool `tfsdk:"detect_drift"`
   Read []resourceCommandReadModel `tfsdk:"read"`
+  Outputs []resourceCommandOutputsModel `tfsdk:"outputs"`
   Update []resourceCommandUpdateModel `tfsdk:"update"`
   Create []resourceCommandCreateModel `tfsdk:"create"`
   Destroy []resourceCommandDestroyModel `tfsdk:"destroy"`
+  Preflight []resourceCommandPreflightModel `tfsdk:"preflight"`
+  Check []resourceCommandCheckModel `tfsdk:"check"`
 }
 
 type resourceCommandReadModel struct {
   Name string `tfsdk:"name"`
   Cmd string `tfsdk:"cmd"`
+  Capture types.String `tfsdk:"capture"`
+  Encoding types.String `tfsdk:"encoding"`
+  DependsOnReads []string `tfsdk:"depends_on_reads"`
+  Sensitive types.Bool `tfsdk:"sensitive"`
+  ExitCodes map[string]string `tfsdk:"exit_codes"`
+  MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
+  Stdin types.String `tfsdk:"stdin"`
+  StdinEncoding types.String `tfsdk:"stdin_encoding"`
+  OnError types.String `tfsdk:"on_error"`
+  Default types.String `tfsdk:"default"`
+  Plan []resourceCommandReadPlanModel `tfsdk:"plan"`
+}
+
+type resourceCommandReadPlanModel struct {
+  Cmd string `tfsdk:"cmd"`
+  Local types.Bool `tfsdk:"local"`
+}
+
+// signature identifies how a variable is read, so that a change in the read block triggers its reloading.
+func (read resourceCommandReadModel) signature() string {
+  signature := read.Cmd
+  if capture := read.Capture.ValueString(); capture != "" && capture != "stdout" {
+    signature += fmt.Sprintf("\n#capture=%s", capture)
+  }
+  if encoding := read.Encoding.ValueString(); encoding != "" && encoding != "text" {
+    signature += fmt.Sprintf("\n#encoding=%s", encoding)
+  }
+  if !read.Stdin.IsNull() {
+    // stdin may be sensitive, only its hash is kept
+    signature += fmt.Sprintf("\n#stdin=%x/%s", sha256.Sum256([]byte(read.Stdin.ValueString())), read.StdinEncoding.ValueString())
+  }
+  return signature
+}
+
+type resourceCommandOutputsModel struct {
+  Names []string `tfsdk:"names"`
+  Sensitive types.Bool `tfsdk:"sensitive"`
+  Cmd string `tfsdk:"cmd"`
+  ExitCodes map[string]string `tfsdk:"exit_codes"`
+  MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
 }
 type resourceCommandUpdateModel struct {
   Triggers []string `tfsdk:"triggers"`
   Reloads []string `tfsdk:"reloads"`
+  Priority types.Int64 `tfsdk:"priority"`
   Cmd string `tfsdk:"cmd"`
+  ExitCodes map[string]string `tfsdk:"exit_codes"`
+  MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
+  Stdin types.String `tfsdk:"stdin"`
+  StdinEncoding types.String `tfsdk:"stdin_encoding"`
 }
 type resourceCommandCreateModel struct {
   Cmd string `tfsdk:"cmd"`
+  ExitCodes map[string]string `tfsdk:"exit_codes"`
+  MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
+  Stdin types.String `tfsdk:"stdin"`
+  StdinEncoding types.String `tfsdk:"stdin_encoding"`
 }
 type resourceCommandDestroyModel struct {
   Cmd string `tfsdk:"cmd"`
+  ExitCodes map[string]string `tfsdk:"exit_codes"`
+  MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
+  Stdin types.String `tfsdk:"stdin"`
+  StdinEncoding types.String `tfsdk:"stdin_encoding"`
+}
+
+type resourceCommandPreflightModel struct {
+  Cmd string `tfsdk:"cmd"`
+  MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
+}
+
+type resourceCommandCheckModel struct {
+  Cmd string `tfsdk:"cmd"`
+  Severity types.String `tfsdk:"severity"`
+  Message types.String `tfsdk:"message"`
+  MaxOutputBytes types.Int64 `tfsdk:"max_output_bytes"`
 }
 
 //type resourceCommandData struct {
@@ -254,6 +569,44 @@ type resourceCommandDestroyModel struct {
 //  return data
 //}
 
+// inputs returns the regular and the sensitive inputs, along with the leaves of the typed inputs.
+func (data *resourceCommandModel) inputs() map[string]types.String {
+  return mergeMaps(data.Input, data.SensitiveInput, data.TypedInputs.leaves())
+}
+
+// inputValues returns the values of the inputs given to the commands, decoded according to input_encodings.
+func (data *resourceCommandModel) inputValues() (map[string]string, diag.Diagnostics) {
+  values, diags := decodeInputs(mergeMaps(data.Input, data.SensitiveInput), data.InputEncodings)
+  return mergeMaps(data.TypedInputs.exported(), values), diags
+}
+
+// contextInputs returns the inputs as they appear in $CONTEXT_JSON.
+func (data *resourceCommandModel) contextInputs() map[string]any {
+  inputs := data.TypedInputs.contextValues()
+  for k, v := range stringValues(mergeMaps(data.Input, data.SensitiveInput)) {
+    inputs[k] = v
+  }
+  return inputs
+}
+
+// delivery prepares the delivery of the decoded inputs, along with the previous inputs and state during an update.
+func (data *resourceCommandModel) delivery(inputs map[string]string, previous *resourceCommandModel) *inputDelivery {
+  context := commandContext{
+    Inputs: data.contextInputs(),
+    State: stringValues(data.states()),
+  }
+  if previous != nil {
+    context.PreviousInputs = previous.contextInputs()
+    context.State = stringValues(previous.states())
+  }
+  return newInputDelivery(data.InputDelivery, inputs, context)
+}
+
+// states returns both the regular and the sensitive state variables.
+func (data *resourceCommandModel) states() map[string]types.String {
+  return mergeMaps(data.State, data.SensitiveState)
+}
+
 func (r *resourceCommand) init(ctx context.Context, data resourceCommandModel) diag.Diagnostics {
   var diags diag.Diagnostics
   if r.shell == nil {
@@ -265,10 +618,25 @@ func (r *resourceCommand) init(ctx context.Context, data resourceCommandModel) d
   return nil
 }
 
+// runner returns the runner of the commands of an operation on the resource with the given id.
+// Their logs name the block of the operation, unless another one is given.
+func (r *resourceCommand) runner(operation string, id types.String) commandRunner {
+  return commandRunner{
+    shell: r.shell,
+    options: r.options,
+    id: id.ValueString(),
+    block: operation,
+    operation: operation,
+    logStdout: true,
+    maxOutputBytes: r.options.MaxOutputBytes,
+  }
+}
+
 // Create is in charge to crete a cmd_local resource.
 func (r *resourceCommand) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
   var data resourceCommandModel
 
+  ctx = maskSensitive(ctx, req.Config.Raw, req.Plan.Raw)
   tflog.Info(ctx, fmt.Sprintf("##### Create:Config #####\n%s\n##### /Create:Config #####", formatVal(req.Config.Raw)))
   tflog.Info(ctx, fmt.Sprintf("##### Create:Plan #####\n%s\n##### /Create:Plan #####", formatVal(req.Plan.Raw)))
 
@@ -289,31 +657,55 @@ func (r *resourceCommand) Create(ctx context.Context, req resource.CreateRequest
     return
   }
 
+  inputs, diags := data.inputValues()
+  if diags.HasError() {
+    resp.Diagnostics.Append(diags...)
+    return
+  }
+
+  data.Id = types.StringValue(generate_id())
   for _, create := range data.Create {
     cmd := create.Cmd
     env := make(map[string]string)
-    for k, v := range data.Input {
-      env[fmt.Sprintf("INPUT_%s", k)] = v.ValueString()
-    }
-    stdout, stderr, combined, err := r.shell.Execute(cmd, env)
-
-    if len(stderr) > 0 {
-      tflog.Warn(ctx, stderr, map[string]any{"cmd": cmd})
+    for k, v := range inputs {
+      env[fmt.Sprintf("INPUT_%s", k)] = v
     }
-    if len(stdout) > 0 {
-      tflog.Info(ctx, stdout, map[string]any{"cmd": cmd})
+    runner, err := r.runner("create", data.Id).withDelivery(data.delivery(inputs, nil)).withOutputLimit(create.MaxOutputBytes).withStdin(create.Stdin, create.StdinEncoding)
+    if err != nil {
+      resp.Diagnostics.AddAttributeError(path.Root("create"), "Invalid stdin", err.Error())
+      return
     }
+    var result commandResult
+    ctx, result = runner.run(ctx, &resp.Diagnostics, cmd, env, create.ExitCodes)
 
-    if err != nil {
-      resp.Diagnostics.AddError("Command error", fmt.Sprintf("Unable to execute command: %s\n%s\n%s", cmd, err, combined))
+    if result.Err != nil {
+      resp.Diagnostics.Append(runner.commandError(ctx, path.Root("create"), "Command error", cmd, result))
       return
     }
   }
 
   data.State = make(map[string]types.String)
-  data.readState(ctx, r.shell, nil, true)
+  data.SensitiveState = make(map[string]types.String)
+  diags, absent := data.readState(ctx, r.runner("create", data.Id), nil, nil, true)
+  resp.Diagnostics.Append(diags...)
+  if absent {
+    resp.Diagnostics.AddError("Resource is absent", "A read command reported the resource as absent after its creation")
+  }
 
-  data.Id = types.StringValue(generate_id())
+  // Every state variable is unknown in the plan of a creation, unless predicted
+  var planned resourceCommandModel
+  resp.Diagnostics.Append(req.Plan.Get(ctx, &planned)...)
+  var names []string
+  for name := range planned.states() {
+    names = append(names, name)
+  }
+  resp.Diagnostics.Append(data.verifyPredictions(planned.predictions(names))...)
+  if !resp.Diagnostics.HasError() {
+    resp.Diagnostics.Append(r.runChecks(ctx, "create", &data)...)
+  }
+
+  data.PlannedAction = types.StringValue("create")
+  resp.Diagnostics.Append(data.storeCommandHashes(ctx, resp.Private)...)
 
   diags = resp.State.Set(ctx, &data)
   resp.Diagnostics.Append(diags...)
@@ -323,6 +715,7 @@ func (r *resourceCommand) Create(ctx context.Context, req resource.CreateRequest
 func (r *resourceCommand) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
   var data resourceCommandModel
 
+  ctx = maskSensitive(ctx, req.State.Raw)
   tflog.Info(ctx, fmt.Sprintf("##### Read:State #####\n%s\n##### /Read:State #####", formatVal(req.State.Raw)))
 
   diags := req.State.Get(ctx, &data)
@@ -337,7 +730,21 @@ func (r *resourceCommand) Read(ctx context.Context, req resource.ReadRequest, re
     return
   }
 
-  data.readState(ctx, r.shell, nil, true)
+  previous := data.states()
+  diags, absent := data.readState(ctx, r.runner("read", data.Id), nil, previous, !data.DetectDrift.ValueBool())
+  resp.Diagnostics.Append(diags...)
+  if absent {
+    tflog.Info(ctx, "A read command reported the resource as absent, it is removed from the state")
+    resp.State.RemoveResource(ctx)
+    return
+  }
+  resp.Diagnostics.Append(r.runChecks(ctx, "read", &data)...)
+
+  // Resources applied before the command hashes were recorded get the ones of their state,
+  // unless they are just imported and have no command yet
+  if stored, _ := req.Private.GetKey(ctx, commandHashesKey); stored == nil && len(data.Create) > 0 {
+    resp.Diagnostics.Append(data.storeCommandHashes(ctx, resp.Private)...)
+  }
 
   diags = resp.State.Set(ctx, &data)
   resp.Diagnostics.Append(diags...)
@@ -347,6 +754,7 @@ func (r *resourceCommand) Read(ctx context.Context, req resource.ReadRequest, re
 func (r *resourceCommand) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
   var plan, state resourceCommandModel
 
+  ctx = maskSensitive(ctx, req.Config.Raw, req.State.Raw, req.Plan.Raw)
   tflog.Info(ctx, fmt.Sprintf("##### Update:Config #####\n%s\n##### /Update:Config #####", formatVal(req.Config.Raw)))
   tflog.Info(ctx, fmt.Sprintf("##### Update:State #####\n%s\n##### /Update:State #####", formatVal(req.State.Raw)))
   tflog.Info(ctx, fmt.Sprintf("##### Update:Plan #####\n%s\n##### /Update:Plan #####", formatVal(req.Plan.Raw)))
@@ -365,46 +773,88 @@ func (r *resourceCommand) Update(ctx context.Context, req resource.UpdateRequest
     return
   }
 
-  update := plan.get_update(state.Input, plan.Input)
+  updates := plan.get_updates(state.inputs(), plan.inputs())
+  changedCommands, diags := plan.changedCommands(ctx, req.Private)
+  resp.Diagnostics.Append(diags...)
+  if commandUpdates := plan.commandChangeUpdates(changedCommands); commandUpdates != nil {
+    updates = commandUpdates
+  }
+  unchanged := len(updates) > 0
+  changes := changeEnv(state.inputs(), plan.inputs(), updates)
+  changes["CHANGED_COMMANDS"] = strings.Join(changedCommands, " ")
 
-  if update != nil {
+  for _, update := range updates {
     cmd := update.Cmd
     env := make(map[string]string)
 
-    for k, v := range plan.Input {
-      env[fmt.Sprintf("INPUT_%s", k)] = v.ValueString()
+    inputs, diags := plan.inputValues()
+    resp.Diagnostics.Append(diags...)
+    previous, diags := state.inputValues()
+    resp.Diagnostics.Append(diags...)
+    if resp.Diagnostics.HasError() {
+      return
     }
-    for k, v := range state.Input {
-      env[fmt.Sprintf("PREVIOUS_%s", k)] = v.ValueString()
+    for k, v := range inputs {
+      env[fmt.Sprintf("INPUT_%s", k)] = v
     }
-    for k, v := range state.State {
-      env[fmt.Sprintf("STATE_%s", k)] = v.ValueString()
+    for k, v := range previous {
+      env[fmt.Sprintf("PREVIOUS_%s", k)] = v
     }
-    stdout, stderr, combined, err := r.shell.Execute(cmd, env)
-
-    if len(stderr) > 0 {
-      tflog.Warn(ctx, stderr, map[string]any{"cmd": cmd})
+    for k, v := range state.states() {
+      env[fmt.Sprintf("STATE_%s", k)] = v.ValueString()
     }
-    if len(stdout) > 0 {
-      tflog.Info(ctx, stdout, map[string]any{"cmd": cmd})
+    runner, err := r.runner("update", plan.Id).withBlock("update" + update.label()).withEnv(changes).withEnv(changeEnv(state.inputs(), plan.inputs(), []*resourceCommandUpdateModel{update})).withDelivery(plan.delivery(inputs, &state)).withOutputLimit(update.MaxOutputBytes).withStdin(update.Stdin, update.StdinEncoding)
+    if err != nil {
+      resp.Diagnostics.AddAttributeError(path.Root("update"), "Invalid stdin", err.Error())
+      return
     }
+    var result commandResult
+    ctx, result = runner.run(ctx, &resp.Diagnostics, cmd, env, update.ExitCodes)
 
-    if err != nil {
-      resp.Diagnostics.AddError("Command error", fmt.Sprintf("Unable to execute command: %s\n%s\n%s", cmd, err, combined))
+    if result.Err != nil {
+      resp.Diagnostics.Append(runner.commandError(ctx, path.Root("update"), "Command error", cmd, result))
       return
     }
+    unchanged = unchanged && result.Outcome == outcomeUnchanged
   }
 
+  // Predicted variables are reloaded to be verified
+  predicted, diags := storedPredictions(ctx, req.Private)
+  resp.Diagnostics.Append(diags...)
+  predictions := plan.predictions(predicted)
+
+  // An unchanged outcome keeps the previous values of the variables instead of reloading them
+  previous := state.states()
   var reloads []string
-  for name, value := range plan.State {
-    if value.IsUnknown() {
+  for name, value := range plan.states() {
+    _, isPredicted := predictions[name]
+    if !value.IsUnknown() && !isPredicted {
+      continue
+    }
+    if previousValue, found := previous[name]; unchanged && found && !isPredicted {
+      if _, found := plan.State[name]; found {
+        plan.State[name] = previousValue
+      } else {
+        plan.SensitiveState[name] = previousValue
+      }
+    } else {
       reloads = append(reloads, name)
     }
   }
-  plan.readState(ctx, r.shell, reloads, true)
-
+  diags, absent := plan.readState(ctx, r.runner("update", plan.Id).withEnv(changes), reloads, previous, true)
+  resp.Diagnostics.Append(diags...)
+  if absent {
+    resp.Diagnostics.AddError("Resource is absent", "A read command reported the resource as absent after its update")
+  }
+  resp.Diagnostics.Append(plan.verifyPredictions(predictions)...)
+  if !resp.Diagnostics.HasError() {
+    resp.Diagnostics.Append(r.runChecks(ctx, "update", &plan)...)
+  }
+  resp.Diagnostics.Append(resp.Private.SetKey(ctx, predictionsKey, []byte("[]"))...)
+  resp.Diagnostics.Append(plan.storeCommandHashes(ctx, resp.Private)...)
 
   resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+  ctx = maskSensitive(ctx, resp.State.Raw)
   tflog.Info(ctx, fmt.Sprintf("##### Update:Output #####\n%s\n##### /Update:Output #####", formatVal(resp.State.Raw)))
 }
 
@@ -412,6 +862,7 @@ func (r *resourceCommand) Update(ctx context.Context, req resource.UpdateRequest
 func (r *resourceCommand) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
   var data resourceCommandModel
 
+  ctx = maskSensitive(ctx, req.State.Raw)
   tflog.Info(ctx, fmt.Sprintf("##### Delete:State #####\n%s\n##### /Delete:State #####", formatVal(req.State.Raw)))
 
   diags := req.State.Get(ctx, &data)
@@ -426,26 +877,31 @@ func (r *resourceCommand) Delete(ctx context.Context, req resource.DeleteRequest
     return
   }
 
+  inputs, diags := data.inputValues()
+  if diags.HasError() {
+    resp.Diagnostics.Append(diags...)
+    return
+  }
+
   for _, destroy := range data.Destroy {
     cmd := destroy.Cmd
     env := make(map[string]string)
-    for k, v := range data.Input {
-      env[fmt.Sprintf("INPUT_%s", k)] = v.ValueString()
+    for k, v := range inputs {
+      env[fmt.Sprintf("INPUT_%s", k)] = v
     }
-    for k, v := range data.State {
+    for k, v := range data.states() {
       env[fmt.Sprintf("STATE_%s", k)] = v.ValueString()
     }
-    stdout, stderr, combined, err := r.shell.Execute(cmd, env)
-
-    if len(stderr) > 0 {
-      tflog.Warn(ctx, stderr, map[string]any{"cmd": cmd})
-    }
-    if len(stdout) > 0 {
-      tflog.Info(ctx, stdout, map[string]any{"cmd": cmd})
+    runner, err := r.runner("destroy", data.Id).withDelivery(data.delivery(inputs, nil)).withOutputLimit(destroy.MaxOutputBytes).withStdin(destroy.Stdin, destroy.StdinEncoding)
+    if err != nil {
+      resp.Diagnostics.AddAttributeError(path.Root("destroy"), "Invalid stdin", err.Error())
+      return
     }
+    var result commandResult
+    ctx, result = runner.run(ctx, &resp.Diagnostics, cmd, env, destroy.ExitCodes)
 
-    if err != nil {
-      resp.Diagnostics.AddError("Command error", fmt.Sprintf("Unable to execute command: %s\n%s\n%s", cmd, err, combined))
+    if result.Err != nil {
+      resp.Diagnostics.Append(runner.commandError(ctx, path.Root("destroy"), "Command error", cmd, result))
       return
     }
   }
@@ -453,13 +909,33 @@ func (r *resourceCommand) Delete(ctx context.Context, req resource.DeleteRequest
   resp.State.RemoveResource(ctx)
 }
 
+// ModifyPlan runs the preflights of a cmd_local resource, then predicts its state with the plan blocks of the reads.
+func (r *resourceCommand) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+  // Nothing to check on destroy
+  if req.Plan.Raw.IsNull() || !req.Plan.Raw.IsKnown() {
+    return
+  }
+
+  ctx = maskSensitive(ctx, req.Config.Raw, req.State.Raw, req.Plan.Raw)
+  r.preflight(ctx, req, resp)
+  if resp.Diagnostics.HasError() {
+    return
+  }
+  r.predictStates(ctx, req, resp)
+}
+
 // ImportState is in charge to import a cmd_local resource into terraform.
 func (r *resourceCommand) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
   //tfsdk.ResourceImportStatePassthroughID(ctx, tftypes.NewAttributePath().WithAttributeName("id"), req, resp)
 }
 
-func (data *resourceCommandModel) readState(ctx context.Context, shell shell, variables []string, state_only bool) []error {
-  var errors []error
+// readState executes the read commands of the variables and stores their result in the state.
+// If variables is nil, all the variables are read.
+// previous holds the values kept by read blocks with `on_error = "keep_previous"` or an unchanged outcome.
+// absent is true if a command reported the resource as absent.
+func (data *resourceCommandModel) readState(ctx context.Context, runner commandRunner, variables []string, previous map[string]types.String, state_only bool) (diags diag.Diagnostics, absent bool) {
+  // Read values are not logged, as they may be sensitive
+  runner.logStdout = false
 
   type void struct{}
   varShouldBeRead := make(map[string]void)
@@ -467,62 +943,217 @@ func (data *resourceCommandModel) readState(ctx context.Context, shell shell, va
     for _, read := range data.Read {
       varShouldBeRead[read.Name] = void{}
     }
+    for _, outputs := range data.Outputs {
+      for _, name := range outputs.Names {
+        varShouldBeRead[name] = void{}
+      }
+    }
   } else {
     for _, v := range variables {
       varShouldBeRead[v] = void{}
     }
+    for _, v := range readDependents(data.Read, variables) {
+      varShouldBeRead[v] = void{}
+    }
+  }
+  inputs, d := data.inputValues()
+  if d.HasError() {
+    diags.Append(d...)
+    return
   }
+  runner = runner.withDelivery(data.delivery(inputs, nil))
   env := make(map[string]string)
-  for k, v := range data.Input {
-    env[fmt.Sprintf("INPUT_%s", k)] = v.ValueString()
+  for k, v := range inputs {
+    env[fmt.Sprintf("INPUT_%s", k)] = v
   }
-  for k, v := range data.State {
+  for k, v := range data.states() {
     env[fmt.Sprintf("STATE_%s", k)] = v.ValueString()
   }
 
-  for _, read := range data.Read {
+  if data.State == nil {
+    data.State = make(map[string]types.String)
+  }
+  if data.SensitiveState == nil {
+    data.SensitiveState = make(map[string]types.String)
+  }
+
+  // store puts the variable in the state or in the sensitive state, and removes it from the other one
+  store := func(name string, value types.String, sensitive bool) {
+    if sensitive {
+      ctx = addSecrets(ctx, value.ValueString())
+      delete(data.State, name)
+      data.SensitiveState[name] = value
+    } else {
+      delete(data.SensitiveState, name)
+      data.State[name] = value
+    }
+  }
+  setValue := func(name string, value string, sensitive bool) {
+    if !state_only {
+      if _, found := data.Input[name]; found {
+        data.Input[name] = types.StringValue(value)
+      }
+      if _, found := data.SensitiveInput[name]; found {
+        data.SensitiveInput[name] = types.StringValue(value)
+      }
+    }
+    store(name, types.StringValue(value), sensitive)
+  }
+  keepPrevious := func(name string, sensitive bool) {
+    value, found := previous[name]
+    if !found || value.IsUnknown() {
+      value = types.StringNull()
+    }
+    store(name, value, sensitive)
+  }
+  // Unknown values cannot be stored in the state and must be nullified
+  setFailed := func(name string, sensitive bool) {
+    value, found := data.states()[name]
+    if !found || value.IsUnknown() {
+      value = types.StringNull()
+    }
+    store(name, value, sensitive)
+  }
+
+  reads, err := sortReads(data.Read)
+  if err != nil {
+    diags.AddError("Invalid read dependency", fmt.Sprintf("%s", err))
+    return diags, false
+  }
+
+  for _, read := range reads {
     name := read.Name
     cmd := read.Cmd
 
     if _, found := varShouldBeRead[name]; !found {
       continue
     }
-    stdout, stderr, _, err := shell.Execute(cmd, env)
 
-    if len(stderr) > 0 {
-      tflog.Warn(ctx, stderr, map[string]any{"cmd": cmd})
+    readEnv := env
+    if len(read.DependsOnReads) > 0 {
+      readEnv = make(map[string]string)
+      for k, v := range env {
+        readEnv[k] = v
+      }
+      states := data.states()
+      for _, dep := range read.DependsOnReads {
+        if value, found := states[dep]; found && !value.IsNull() && !value.IsUnknown() {
+          readEnv[fmt.Sprintf("READ_%s", dep)] = value.ValueString()
+        }
+      }
+    }
+    sensitive := read.Sensitive.ValueBool()
+    readRunner, err := runner.withBlock("read." + name).withCapture(read.Capture.ValueString(), read.Encoding.ValueString()).withOutputLimit(read.MaxOutputBytes).withStdin(read.Stdin, read.StdinEncoding)
+    if err != nil {
+      setFailed(name, sensitive)
+      diags.AddAttributeError(path.Root("read"), fmt.Sprintf("Unable to read %s", name), err.Error())
+      continue
+    }
+    var result commandResult
+    ctx, result = readRunner.run(ctx, &diags, cmd, readEnv, read.ExitCodes)
+    switch result.Outcome {
+    case outcomeAbsent:
+      absent = true
+      continue
+    case outcomeUnchanged:
+      keepPrevious(name, sensitive)
+      continue
+    }
+    value, err := captureOutput(read.Capture.ValueString(), result)
+    if err == nil {
+      value, err = encodeOutput(read.Encoding.ValueString(), value)
     }
     if err == nil {
-      if _, found := data.Input[name]; !state_only && found {
-        data.Input[name] = types.StringValue(stdout)
+      setValue(name, value, sensitive)
+      continue
+    }
+
+    onError := read.OnError.ValueString()
+    if read.OnError.IsNull() {
+      if read.Default.IsNull() {
+        onError = "fail"
+      } else {
+        onError = "default"
       }
-      data.State[name] = types.StringValue(stdout)
-    } else {
-      errors = append(errors, err)
     }
+
+    switch onError {
+    case "keep_previous":
+      keepPrevious(name, sensitive)
+    case "null":
+      store(name, types.StringNull(), sensitive)
+    case "default":
+      store(name, types.StringValue(read.Default.ValueString()), sensitive)
+    default:
+      setFailed(name, sensitive)
+      result.Err = err
+      diags.Append(readRunner.commandError(ctx, path.Root("read"), fmt.Sprintf("Unable to read %s", name), cmd, result))
+      continue
+    }
+    tflog.Warn(ctx, fmt.Sprintf("Unable to read %s (%s), using on_error = %s", name, err, onError), map[string]any{"cmd": cmd})
   }
 
-  return errors
-}
+  for _, outputs := range data.Outputs {
+    var names []string
+    for _, name := range outputs.Names {
+      if _, found := varShouldBeRead[name]; found {
+        names = append(names, name)
+      }
+    }
+    if len(names) == 0 {
+      continue
+    }
 
-// get_update search for the right command to execute satisfying the update policies of the resource.
-func (rules *resourceCommandModel) get_update(state map[string]types.String, plan map[string]types.String) *resourceCommandUpdateModel {
-  var modified []string
-  for k, x := range state {
-    if y, found := plan[k]; !found || x != y {
-      modified = append(modified, k)
+    cmd := outputs.Cmd
+    sensitive := outputs.Sensitive.ValueBool()
+    var result commandResult
+    ctx, result = runner.withBlock("outputs").withStateOutput().withOutputLimit(outputs.MaxOutputBytes).run(ctx, &diags, cmd, env, outputs.ExitCodes)
+    switch result.Outcome {
+    case outcomeAbsent:
+      absent = true
+      continue
+    case outcomeUnchanged:
+      for _, name := range names {
+        keepPrevious(name, sensitive)
+      }
+      continue
     }
-  }
-  for k, _ := range plan {
-    if _, found := state[k]; !found {
-      modified = append(modified, k)
+
+    var values map[string]string
+    err := result.Err
+    if _, found := result.Spilled["stdout"]; found && err == nil {
+      err = spilledError("stdout", result)
+    }
+    if err == nil {
+      if len(result.Stdout) > 0 {
+        tflog.Info(ctx, result.Stdout, map[string]any{"cmd": cmd})
+      }
+      values, err = parseStateOutput(result.StateOutput)
+    }
+    if err != nil {
+      for _, name := range names {
+        setFailed(name, sensitive)
+      }
+      result.Err = err
+      diags.Append(runner.commandError(ctx, path.Root("outputs"), fmt.Sprintf("Unable to read %s", strings.Join(names, ", ")), cmd, result))
+      continue
+    }
+
+    for _, name := range names {
+      if value, found := values[name]; found {
+        setValue(name, value, sensitive)
+      } else {
+        setFailed(name, sensitive)
+        diags.AddAttributeError(path.Root("outputs"), fmt.Sprintf("Unable to read %s", name), fmt.Sprintf("%s has not been written into STATE_OUTPUT by the command:\n%s", name, cmd))
+      }
     }
   }
-  if len(modified) == 0 {
-    return nil
-  }
-  sort.Strings(modified)
 
+  return diags, absent
+}
+
+// get_update search for the right command to execute satisfying the update policies of the resource.
+func (rules *resourceCommandModel) get_update(modified []string) *resourceCommandUpdateModel {
   var trig []string
   var rule *resourceCommandUpdateModel = nil
 
@@ -534,18 +1165,170 @@ func (rules *resourceCommandModel) get_update(state map[string]types.String, pla
       if rule == nil {
         rule = update
       }
-    } else if len(triggers) >= len(modified) && (len(trig) == 0 || len(trig) > len(triggers)) {
-      _, _, right := sorted_list_3way(triggers, modified)
-      if len(right) == 0 {
-        trig = triggers
-        rule = update
-      }
+    } else if (len(trig) == 0 || len(trig) > len(triggers) || len(trig) == len(triggers) && literalTriggers(triggers) && !literalTriggers(trig)) && triggersCover(triggers, modified) {
+      trig = triggers
+      rule = update
     }
   }
 
   return rule
 }
 
+// get_updates searches for the update rules to execute, in order, according to the update strategy of the resource.
+// It returns nil if the resource must be replaced, and an empty list if the modified inputs are all ignored.
+func (rules *resourceCommandModel) get_updates(state map[string]types.String, plan map[string]types.String) []*resourceCommandUpdateModel {
+  modified, _, _ := inputChanges(state, plan)
+  if len(modified) == 0 {
+    return nil
+  }
+
+  // replace_on takes precedence over both ignore_changes_of and the update rules
+  var relevant []string
+  for _, key := range modified {
+    if triggersCover(rules.ReplaceOn, []string{key}) {
+      return nil
+    }
+    if !triggersCover(rules.IgnoreChangesOf, []string{key}) {
+      relevant = append(relevant, key)
+    }
+  }
+  modified = relevant
+  if len(modified) == 0 {
+    return []*resourceCommandUpdateModel{}
+  }
+
+  if rules.UpdateStrategy.ValueString() != "compose" {
+    if rule := rules.get_update(modified); rule != nil {
+      return []*resourceCommandUpdateModel{rule}
+    }
+    return nil
+  }
+
+  var selected []*resourceCommandUpdateModel
+  var fallback *resourceCommandUpdateModel
+  covered := make([]bool, len(modified))
+  for i := range rules.Update {
+    update := &rules.Update[i]
+    if len(update.Triggers) == 0 {
+      if fallback == nil {
+        fallback = update
+      }
+      continue
+    }
+    matched := false
+    for j, key := range modified {
+      if triggersCover(update.Triggers, []string{key}) {
+        covered[j] = true
+        matched = true
+      }
+    }
+    if matched {
+      selected = append(selected, update)
+    }
+  }
+
+  for _, c := range covered {
+    if !c {
+      if fallback == nil {
+        return nil
+      }
+      selected = append(selected, fallback)
+      break
+    }
+  }
+
+  sortUpdates(selected)
+  return selected
+}
+
+// sortedTriggers returns the triggers of an update rule in order, as the set they come from has none.
+func (update *resourceCommandUpdateModel) sortedTriggers() []string {
+  triggers := append([]string(nil), update.Triggers...)
+  sort.Strings(triggers)
+  return triggers
+}
+
+// label names an update rule by its triggers, like `[a, b]`, or `[*]` for a rule without triggers.
+func (update *resourceCommandUpdateModel) label() string {
+  if len(update.Triggers) == 0 {
+    return "[*]"
+  }
+  return fmt.Sprintf("[%s]", strings.Join(update.sortedTriggers(), ", "))
+}
+
+// sortUpdates orders update rules by priority, then by triggers.
+func sortUpdates(updates []*resourceCommandUpdateModel) {
+  sort.SliceStable(updates, func(i, j int) bool {
+    pi, pj := updates[i].Priority.ValueInt64(), updates[j].Priority.ValueInt64()
+    if pi != pj {
+      return pi < pj
+    }
+    return strings.Join(updates[i].sortedTriggers(), ",") < strings.Join(updates[j].sortedTriggers(), ",")
+  })
+}
+
+// inputChanges lists, in name order, the inputs modified between the state and the plan, and among them the added and removed ones.
+func inputChanges(state map[string]types.String, plan map[string]types.String) (modified, added, removed []string) {
+  for k, x := range state {
+    if y, found := plan[k]; !found {
+      modified = append(modified, k)
+      removed = append(removed, k)
+    } else if x != y {
+      modified = append(modified, k)
+    }
+  }
+  for k := range plan {
+    if _, found := state[k]; !found {
+      modified = append(modified, k)
+      added = append(added, k)
+    }
+  }
+  sort.Strings(modified)
+  sort.Strings(added)
+  sort.Strings(removed)
+  return
+}
+
+// changeEnv describes to the commands of an update which inputs are modified, and the triggers of the selected update rules.
+func changeEnv(state map[string]types.String, plan map[string]types.String, rules []*resourceCommandUpdateModel) map[string]string {
+  modified, added, removed := inputChanges(state, plan)
+  type void struct{}
+  seen := make(map[string]void)
+  var triggers []string
+  for _, rule := range rules {
+    for _, trigger := range rule.Triggers {
+      if _, found := seen[trigger]; !found {
+        seen[trigger] = void{}
+        triggers = append(triggers, trigger)
+      }
+    }
+  }
+  sort.Strings(triggers)
+  return map[string]string{
+    "CHANGED_INPUTS": strings.Join(modified, " "),
+    "ADDED_INPUTS": strings.Join(added, " "),
+    "REMOVED_INPUTS": strings.Join(removed, " "),
+    "UPDATE_TRIGGERS": strings.Join(triggers, " "),
+  }
+}
+
+// triggersCover checks if every modified input is matched by at least one trigger.
+func triggersCover(triggers []string, modified []string) bool {
+  for _, key := range modified {
+    covered := false
+    for _, trigger := range triggers {
+      if matchInputPath(trigger, key) {
+        covered = true
+        break
+      }
+    }
+    if !covered {
+      return false
+    }
+  }
+  return true
+}
+
 type inputPlanModifier struct {}
 
 func (_ inputPlanModifier) Description(ctx context.Context) string {
@@ -559,6 +1342,7 @@ func (_ inputPlanModifier) MarkdownDescription(ctx context.Context) string {
 func (_ inputPlanModifier) Modify(ctx context.Context, req tfsdk.ModifyAttributePlanRequest, resp *tfsdk.ModifyAttributePlanResponse) {
   var plan, state resourceCommandModel
 
+  ctx = maskSensitive(ctx, req.State.Raw, req.Plan.Raw)
   tflog.Info(ctx, fmt.Sprintf("##### InputPlanModify:State #####\n%s\n##### /InputPlanModify:State #####", formatVal(req.State.Raw)))
   tflog.Info(ctx, fmt.Sprintf("##### InputPlanModify:Plan #####\n%s\n##### /InputPlanModify:Plan #####", formatVal(req.Plan.Raw)))
 
@@ -575,68 +1359,90 @@ func (_ inputPlanModifier) Modify(ctx context.Context, req tfsdk.ModifyAttribute
   diags = req.State.Get(ctx, &state)
   resp.Diagnostics.Append(diags...)
 
-  rule := state.get_update(state.Input, plan.Input)
-  if rule == nil {
+  // The update strategy and the replace and ignore lists are the planned ones
+  state.UpdateStrategy = plan.UpdateStrategy
+  state.ReplaceOn = plan.ReplaceOn
+  state.IgnoreChangesOf = plan.IgnoreChangesOf
+  if rules := state.get_updates(state.inputs(), plan.inputs()); rules == nil {
     resp.RequiresReplace = true
   }
 }
 
-type statePlanModifier struct {}
-
-func (_ statePlanModifier) Description(ctx context.Context) string {
-  return "Checks if the resource must be replaced depending on which inputs are plan to be modified"
-}
-
-func (_ statePlanModifier) MarkdownDescription(ctx context.Context) string {
-  return "Checks if the resource must be replaced depending on which inputs are plan to be modified"
+// statePlan is the planning of the variables of the state and the sensitive state: unknown ones are reloaded.
+type statePlan struct {
+  config resourceCommandModel
+  stateInputs map[string]types.String
+  planInputs map[string]types.String
+  rules []*resourceCommandUpdateModel
+  changedCommands []string
+  elems map[string]attr.Value
 }
 
-func (_ statePlanModifier) Modify(ctx context.Context, req tfsdk.ModifyAttributePlanRequest, resp *tfsdk.ModifyAttributePlanResponse) {
-  tflog.Info(ctx, fmt.Sprintf("##### StatePlanModify:State #####\n%s\n##### /StatePlanModify:State #####", formatVal(req.State.Raw)))
-  tflog.Info(ctx, fmt.Sprintf("##### StatePlanModify:Config #####\n%s\n##### /StatePlanModify:Config #####", formatVal(req.Config.Raw)))
-  tflog.Info(ctx, fmt.Sprintf("##### StatePlanModify:Plan #####\n%s\n##### /StatePlanModify:Plan #####", formatVal(req.Plan.Raw)))
-
-  // No modification on destroy
-  if req.Plan.Raw.IsNull() || !req.Plan.Raw.IsKnown() {
-    return
-  }
-
-  tflog.Info(ctx, "##### Apply StatePlanModify #####")
-
-  var config resourceCommandModel
+// planStates plans the variables of both the state and the sensitive state.
+func planStates(ctx context.Context, req tfsdk.ModifyAttributePlanRequest) (statePlan, diag.Diagnostics) {
+  var planned statePlan
+  var diags diag.Diagnostics
+  config := &planned.config
 
-  resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+  diags.Append(req.Config.Get(ctx, config)...)
 
   configReadData := config.Read
   stateData := map[string]types.String{}
+  stateSensitiveData := map[string]types.String{}
   stateInputData := map[string]types.String{}
+  stateSensitiveInputData := map[string]types.String{}
   stateReadData := []resourceCommandReadModel{}
+  stateOutputsData := []resourceCommandOutputsModel{}
   planInputData := map[string]types.String{}
+  planSensitiveInputData := map[string]types.String{}
+  var stateTypedInputData, planTypedInputData dynamicValue
 
-  resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("inputs"), &planInputData)...)
+  diags.Append(req.Plan.GetAttribute(ctx, path.Root("inputs"), &planInputData)...)
+  diags.Append(req.Plan.GetAttribute(ctx, path.Root("sensitive_inputs"), &planSensitiveInputData)...)
+  diags.Append(req.Plan.GetAttribute(ctx, path.Root("typed_inputs"), &planTypedInputData)...)
 
   // If this is not a resource creation, we must read the state
   if !req.State.Raw.IsNull() && req.State.Raw.IsKnown() {
-    resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("state"), &stateData)...)
-    resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("inputs"), &stateInputData)...)
-    resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("read"), &stateReadData)...)
+    diags.Append(req.State.GetAttribute(ctx, path.Root("state"), &stateData)...)
+    diags.Append(req.State.GetAttribute(ctx, path.Root("sensitive_state"), &stateSensitiveData)...)
+    diags.Append(req.State.GetAttribute(ctx, path.Root("inputs"), &stateInputData)...)
+    diags.Append(req.State.GetAttribute(ctx, path.Root("sensitive_inputs"), &stateSensitiveInputData)...)
+    diags.Append(req.State.GetAttribute(ctx, path.Root("typed_inputs"), &stateTypedInputData)...)
+    diags.Append(req.State.GetAttribute(ctx, path.Root("read"), &stateReadData)...)
+    diags.Append(req.State.GetAttribute(ctx, path.Root("outputs"), &stateOutputsData)...)
   }
+  stateData = mergeMaps(stateData, stateSensitiveData)
+  stateInputData = mergeMaps(stateInputData, stateSensitiveInputData, stateTypedInputData.leaves())
+  planInputData = mergeMaps(planInputData, planSensitiveInputData, planTypedInputData.leaves())
 
   stateRead := make(map[string]string)
   elems := make(map[string]attr.Value)
 
-  rule := config.get_update(stateInputData, planInputData)
-  reloadAll := rule != nil && rule.Reloads == nil
+  rules := config.get_updates(stateInputData, planInputData)
+  changedCommands, d := config.changedCommands(ctx, req.Private)
+  diags.Append(d...)
+  if commandUpdates := config.commandChangeUpdates(changedCommands); commandUpdates != nil {
+    rules = commandUpdates
+  }
+  reloadAll := false
+  for _, rule := range rules {
+    reloadAll = reloadAll || rule.Reloads == nil
+  }
 
   for _, read := range stateReadData {
-    stateRead[read.Name] = read.Cmd
+    stateRead[read.Name] = read.signature()
   }
-  for _, read := range configReadData {
-    name := read.Name
+  for _, outputs := range stateOutputsData {
+    for _, name := range outputs.Names {
+      stateRead[name] = outputs.Cmd
+    }
+  }
+
+  planElem := func(name string, cmd string) {
     elem := types.StringUnknown()
     if !reloadAll {
       stateCmd, cmdFound := stateRead[name]
-      if cmdFound && stateCmd == read.Cmd {
+      if cmdFound && stateCmd == cmd {
         value, valueFound := stateData[name]
         if valueFound {
           elem = value
@@ -646,15 +1452,94 @@ func (_ statePlanModifier) Modify(ctx context.Context, req tfsdk.ModifyAttribute
     elems[name] = elem
   }
 
-  if rule != nil {
+  for _, read := range configReadData {
+    planElem(read.Name, read.signature())
+  }
+  for _, outputs := range config.Outputs {
+    for _, name := range outputs.Names {
+      planElem(name, outputs.Cmd)
+    }
+  }
+
+  for _, rule := range rules {
     for _, reload := range rule.Reloads {
       elems[reload] = types.StringUnknown()
     }
   }
 
-  m, diags := types.MapValue(types.StringType, elems)
+  // Reads depending on reloaded variables must be reloaded as well
+  var unknowns []string
+  for name, elem := range elems {
+    if elem.(types.String).IsUnknown() {
+      unknowns = append(unknowns, name)
+    }
+  }
+  for _, name := range readDependents(configReadData, unknowns) {
+    elems[name] = types.StringUnknown()
+  }
+
+  planned.stateInputs = stateInputData
+  planned.planInputs = planInputData
+  planned.rules = rules
+  planned.changedCommands = changedCommands
+  planned.elems = elems
+  return planned, diags
+}
+
+// statePlanModifier plans the variables of either the state or the sensitive state.
+type statePlanModifier struct {
+  sensitive bool
+}
+
+func (_ statePlanModifier) Description(ctx context.Context) string {
+  return "Checks if the resource must be replaced depending on which inputs are plan to be modified"
+}
+
+func (_ statePlanModifier) MarkdownDescription(ctx context.Context) string {
+  return "Checks if the resource must be replaced depending on which inputs are plan to be modified"
+}
+
+func (m statePlanModifier) Modify(ctx context.Context, req tfsdk.ModifyAttributePlanRequest, resp *tfsdk.ModifyAttributePlanResponse) {
+  ctx = maskSensitive(ctx, req.State.Raw, req.Config.Raw, req.Plan.Raw)
+  tflog.Info(ctx, fmt.Sprintf("##### StatePlanModify:State #####\n%s\n##### /StatePlanModify:State #####", formatVal(req.State.Raw)))
+  tflog.Info(ctx, fmt.Sprintf("##### StatePlanModify:Config #####\n%s\n##### /StatePlanModify:Config #####", formatVal(req.Config.Raw)))
+  tflog.Info(ctx, fmt.Sprintf("##### StatePlanModify:Plan #####\n%s\n##### /StatePlanModify:Plan #####", formatVal(req.Plan.Raw)))
+
+  // No modification on destroy
+  if req.Plan.Raw.IsNull() || !req.Plan.Raw.IsKnown() {
+    return
+  }
+
+  tflog.Info(ctx, "##### Apply StatePlanModify #####")
+
+  states, diags := planStates(ctx, req)
+  resp.Diagnostics.Append(diags...)
+  config, configReadData, elems := states.config, states.config.Read, states.elems
+
+  // Only keep the variables stored in this attribute
+  type void struct{}
+  sensitive := make(map[string]void)
+  for _, read := range configReadData {
+    if read.Sensitive.ValueBool() {
+      sensitive[read.Name] = void{}
+    }
+  }
+  for _, outputs := range config.Outputs {
+    if outputs.Sensitive.ValueBool() {
+      for _, name := range outputs.Names {
+        sensitive[name] = void{}
+      }
+    }
+  }
+  for name := range elems {
+    if _, found := sensitive[name]; found != m.sensitive {
+      delete(elems, name)
+    }
+  }
+
+  planned, diags := types.MapValue(types.StringType, elems)
   resp.Diagnostics.Append(diags...)
-  resp.AttributePlan = m
+  resp.AttributePlan = planned
 }
 
 type updateReloadValidator struct {}
@@ -671,12 +1556,18 @@ func (_ updateReloadValidator) Validate(ctx context.Context, req tfsdk.ValidateA
   }
 
   var readModel []resourceCommandReadModel
+  var outputsModel []resourceCommandOutputsModel
 
   diags := req.Config.GetAttribute(ctx, path.Root("read"), &readModel)
   resp.Diagnostics.Append(diags...)
   if diags.HasError() {
     return
   }
+  diags = req.Config.GetAttribute(ctx, path.Root("outputs"), &outputsModel)
+  resp.Diagnostics.Append(diags...)
+  if diags.HasError() {
+    return
+  }
 
   type void struct{}
   vars := make(map[string]void)
@@ -684,6 +1575,11 @@ func (_ updateReloadValidator) Validate(ctx context.Context, req tfsdk.ValidateA
   for _, read := range readModel {
     vars[read.Name] = void{}
   }
+  for _, outputs := range outputsModel {
+    for _, name := range outputs.Names {
+      vars[name] = void{}
+    }
+  }
 
   var reloads []types.String
   diags = tfsdk.ValueAs(ctx, req.AttributeConfig, &reloads)
@@ -692,12 +1588,112 @@ func (_ updateReloadValidator) Validate(ctx context.Context, req tfsdk.ValidateA
     if !name.IsUnknown() && !name.IsNull() {
       if _, found := vars[name.ValueString()]; !found {
         path := req.AttributePath.AtSetValue(name)
-        resp.Diagnostics.AddAttributeError(path, "Invalid reload specification for update block", fmt.Sprintf("%s request the reloading of the variable %s, but it does not exit (ie: there is no read block with such a name).", path, name))
+        resp.Diagnostics.AddAttributeError(path, "Invalid reload specification for update block", fmt.Sprintf("%s request the reloading of the variable %s, but it does not exit (ie: there is no read block nor outputs block with such a name).", path, name))
+      }
+    }
+  }
+}
+
+type sensitiveInputsValidator struct {}
+
+func (_ sensitiveInputsValidator) Description(ctx context.Context) string {
+  return "Validates that sensitive inputs do not collide with inputs"
+}
+func (_ sensitiveInputsValidator) MarkdownDescription(ctx context.Context) string {
+  return "Validates that sensitive inputs do not collide with inputs"
+}
+func (_ sensitiveInputsValidator) Validate(ctx context.Context, req tfsdk.ValidateAttributeRequest, resp *tfsdk.ValidateAttributeResponse) {
+  if req.AttributeConfig.IsUnknown() || req.AttributeConfig.IsNull() {
+    return
+  }
+
+  var inputs types.Map
+
+  diags := req.Config.GetAttribute(ctx, path.Root("inputs"), &inputs)
+  resp.Diagnostics.Append(diags...)
+  if diags.HasError() || inputs.IsNull() || inputs.IsUnknown() {
+    return
+  }
+  sensitiveInputs, ok := req.AttributeConfig.(types.Map)
+  if !ok {
+    return
+  }
+
+  for name := range sensitiveInputs.Elements() {
+    if _, found := inputs.Elements()[name]; found {
+      resp.Diagnostics.AddAttributeError(req.AttributePath.AtMapKey(name), "Invalid sensitive input", fmt.Sprintf("%s is already defined in inputs.", name))
+    }
+  }
+}
+
+type outputsNameValidator struct {}
+
+func (_ outputsNameValidator) Description(ctx context.Context) string {
+  return "Validates the names of the outputs block"
+}
+func (_ outputsNameValidator) MarkdownDescription(ctx context.Context) string {
+  return "Validates the names of the outputs block"
+}
+func (_ outputsNameValidator) Validate(ctx context.Context, req tfsdk.ValidateAttributeRequest, resp *tfsdk.ValidateAttributeResponse) {
+  if req.AttributeConfig.IsUnknown() || req.AttributeConfig.IsNull() {
+    return
+  }
+
+  var readModel []resourceCommandReadModel
+
+  diags := req.Config.GetAttribute(ctx, path.Root("read"), &readModel)
+  resp.Diagnostics.Append(diags...)
+  if diags.HasError() {
+    return
+  }
+
+  type void struct{}
+  vars := make(map[string]void)
+
+  for _, read := range readModel {
+    vars[read.Name] = void{}
+  }
+
+  var names []types.String
+  diags = tfsdk.ValueAs(ctx, req.AttributeConfig, &names)
+
+  for _, name := range names {
+    if !name.IsUnknown() && !name.IsNull() {
+      if _, found := vars[name.ValueString()]; found {
+        path := req.AttributePath.AtSetValue(name)
+        resp.Diagnostics.AddAttributeError(path, "Invalid outputs specification", fmt.Sprintf("%s is already read by a read block.", name))
       }
     }
   }
 }
 
+type readOnErrorValidator struct {}
+
+func (_ readOnErrorValidator) Description(ctx context.Context) string {
+  return "Validates that default is set exactly when on_error is default"
+}
+func (_ readOnErrorValidator) MarkdownDescription(ctx context.Context) string {
+  return "Validates that default is set exactly when on_error is default"
+}
+func (_ readOnErrorValidator) Validate(ctx context.Context, req tfsdk.ValidateAttributeRequest, resp *tfsdk.ValidateAttributeResponse) {
+  reads, ok := configuredReads(ctx, req.AttributeConfig)
+  if !ok {
+    return
+  }
+
+  for _, read := range reads {
+    if read.OnError.IsUnknown() || read.Default.IsUnknown() || read.OnError.IsNull() {
+      continue
+    }
+    onError := read.OnError.ValueString()
+    if onError == "default" && read.Default.IsNull() {
+      resp.Diagnostics.AddAttributeError(req.AttributePath, "Invalid read error handling", fmt.Sprintf("Read %s has on_error = \"default\", but no default value.", read.Name))
+    }
+    if onError != "default" && !read.Default.IsNull() {
+      resp.Diagnostics.AddAttributeError(req.AttributePath, "Invalid read error handling", fmt.Sprintf("Read %s has a default value, which is not used with on_error = %q.", read.Name, onError))
+    }
+  }
+}
 
 type updateAmbiguityValidator struct {}
 
@@ -730,13 +1726,20 @@ func (_ updateAmbiguityValidator) Validate(ctx context.Context, req tfsdk.Valida
     seen[triggers0] = void{}
 
     for _, update1 := range data.Update {
-      left, inner, right := sorted_list_3way(update0.Triggers, update1.Triggers)
+      // Patterns overlap when some input could be matched by both
+      inner, left := overlappingTriggers(update0.Triggers, update1.Triggers)
+      _, right := overlappingTriggers(update1.Triggers, update0.Triggers)
       if len(left) > 0 && len(inner) > 0 && len(right) > 0 {
         conflict[strings.Join(inner, ",")] = void{}
       }
     }
   }
 
+  // Composed updates run all the matching rules, which cannot be ambiguous
+  if data.UpdateStrategy.ValueString() == "compose" {
+    return
+  }
+
   for k := range conflict {
     if _, found := seen[k]; !found {
       resp.Diagnostics.AddError("Update Ambiguity", fmt.Sprintf("Update of %s would lead to ambiguous update rule", k))
@@ -0,0 +1,626 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// testResource gives access to a resource through a configured provider server.
+type testResource struct {
+	t      *testing.T
+	server tfprotov6.ProviderServer
+	name   string
+	typ    tftypes.Object
+}
+
+func newTestResource(t *testing.T) testResource {
+	return newTestResourceType(t, "cmd_local")
+}
+
+func newTestResourceType(t *testing.T, name string) testResource {
+	ctx := context.Background()
+	server := providerserver.NewProtocol6(New())()
+	schema, err := server.GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerType := schema.Provider.ValueType()
+	providerConfig, err := tfprotov6.NewDynamicValue(providerType, testObject(providerType.(tftypes.Object), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := server.ConfigureProvider(ctx, &tfprotov6.ConfigureProviderRequest{Config: &providerConfig}); err != nil || len(resp.Diagnostics) > 0 {
+		t.Fatalf("unable to configure the provider: %v %v", err, testErrors(resp.Diagnostics))
+	}
+	return testResource{
+		t:      t,
+		server: server,
+		name:   name,
+		typ:    schema.ResourceSchemas[name].ValueType().(tftypes.Object),
+	}
+}
+
+// testObject builds an object value, whose missing attributes are null, or empty for blocks.
+func testObject(typ tftypes.Object, attrs map[string]tftypes.Value) tftypes.Value {
+	values := make(map[string]tftypes.Value)
+	for name, attrType := range typ.AttributeTypes {
+		if value, found := attrs[name]; found {
+			values[name] = value
+		} else if attrType.Is(tftypes.List{}) || attrType.Is(tftypes.Set{}) {
+			values[name] = tftypes.NewValue(attrType, []tftypes.Value{})
+		} else {
+			values[name] = tftypes.NewValue(attrType, nil)
+		}
+	}
+	return tftypes.NewValue(typ, values)
+}
+
+// config builds a resource configuration from its attributes.
+// Blocks are given as the attributes of their elements.
+func (r testResource) config(attrs map[string]tftypes.Value, blocks map[string][]map[string]tftypes.Value) tftypes.Value {
+	values := make(map[string]tftypes.Value)
+	for name, value := range attrs {
+		values[name] = value
+	}
+	for name, elems := range blocks {
+		blockType := r.typ.AttributeTypes[name]
+		var elemType tftypes.Object
+		switch t := blockType.(type) {
+		case tftypes.Set:
+			elemType = t.ElementType.(tftypes.Object)
+		case tftypes.List:
+			elemType = t.ElementType.(tftypes.Object)
+		}
+		var elemValues []tftypes.Value
+		for _, elem := range elems {
+			elemValues = append(elemValues, testObject(elemType, elem))
+		}
+		values[name] = tftypes.NewValue(blockType, elemValues)
+	}
+	if _, found := values["inputs"]; !found {
+		values["inputs"] = tftypes.NewValue(r.typ.AttributeTypes["inputs"], map[string]tftypes.Value{})
+	}
+	// An empty set would disable the environment variables
+	if _, found := values["input_delivery"]; !found {
+		values["input_delivery"] = tftypes.NewValue(r.typ.AttributeTypes["input_delivery"], nil)
+	}
+	return testObject(r.typ, values)
+}
+
+func (r testResource) dynamic(value tftypes.Value) *tfprotov6.DynamicValue {
+	dynamic, err := tfprotov6.NewDynamicValue(r.typ, value)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return &dynamic
+}
+
+// validate validates a configuration, and returns its diagnostics.
+func (r testResource) validate(config tftypes.Value) []*tfprotov6.Diagnostic {
+	resp, err := r.server.ValidateResourceConfig(context.Background(), &tfprotov6.ValidateResourceConfigRequest{
+		TypeName: r.name,
+		Config:   r.dynamic(config),
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return resp.Diagnostics
+}
+
+// planCreate plans the creation of a resource, and returns its diagnostics.
+func (r testResource) planCreate(config tftypes.Value) []*tfprotov6.Diagnostic {
+	resp, err := r.server.PlanResourceChange(context.Background(), &tfprotov6.PlanResourceChangeRequest{
+		TypeName:         r.name,
+		Config:           r.dynamic(config),
+		ProposedNewState: r.dynamic(config),
+		PriorState:       r.dynamic(tftypes.NewValue(r.typ, nil)),
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return resp.Diagnostics
+}
+
+// planUpdate plans the update of a resource created with the prior configuration.
+func (r testResource) planUpdate(prior tftypes.Value, config tftypes.Value) *tfprotov6.PlanResourceChangeResponse {
+	var attrs map[string]tftypes.Value
+	if err := prior.As(&attrs); err != nil {
+		r.t.Fatal(err)
+	}
+	attrs["id"] = testString("some-id")
+	for _, name := range []string{"state", "sensitive_state"} {
+		attrs[name] = tftypes.NewValue(r.typ.AttributeTypes[name], map[string]tftypes.Value{})
+	}
+	resp, err := r.server.PlanResourceChange(context.Background(), &tfprotov6.PlanResourceChangeRequest{
+		TypeName:         r.name,
+		Config:           r.dynamic(config),
+		ProposedNewState: r.dynamic(config),
+		PriorState:       r.dynamic(tftypes.NewValue(r.typ, attrs)),
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if errors := testErrors(resp.Diagnostics); len(errors) > 0 {
+		r.t.Fatalf("unable to plan the update: %v", errors)
+	}
+	return resp
+}
+
+func testString(s string) tftypes.Value {
+	return tftypes.NewValue(tftypes.String, s)
+}
+
+func testErrors(diags []*tfprotov6.Diagnostic) []string {
+	var errors []string
+	for _, d := range diags {
+		if d.Severity == tfprotov6.DiagnosticSeverityError {
+			errors = append(errors, d.Summary+": "+d.Detail)
+		}
+	}
+	return errors
+}
+
+func TestReadOnErrorValidator(t *testing.T) {
+	r := newTestResource(t)
+	null := tftypes.NewValue(tftypes.String, nil)
+	tests := []struct {
+		name    string
+		onError tftypes.Value
+		def     tftypes.Value
+		wantErr bool
+	}{
+		{name: "nothing", onError: null, def: null},
+		{name: "implied default", onError: null, def: testString("x")},
+		{name: "default", onError: testString("default"), def: testString("x")},
+		{name: "empty default", onError: testString("default"), def: testString("")},
+		{name: "missing default", onError: testString("default"), def: null, wantErr: true},
+		{name: "fail", onError: testString("fail"), def: null},
+		{name: "fail with default", onError: testString("fail"), def: testString("x"), wantErr: true},
+		{name: "null with default", onError: testString("null"), def: testString("x"), wantErr: true},
+		{name: "unknown default", onError: testString("fail"), def: tftypes.NewValue(tftypes.String, tftypes.UnknownValue)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := r.config(nil, map[string][]map[string]tftypes.Value{
+				"read": {{"name": testString("a"), "cmd": testString("echo"), "on_error": test.onError, "default": test.def}},
+			})
+			errors := testErrors(r.validate(config))
+			if test.wantErr && (len(errors) != 1 || !strings.HasPrefix(errors[0], "Invalid read error handling")) {
+				t.Errorf("expected an invalid error handling, got %v", errors)
+			}
+			if !test.wantErr && len(errors) > 0 {
+				t.Errorf("unexpected errors: %v", errors)
+			}
+		})
+	}
+}
+
+func TestTypedInputsNestedNulls(t *testing.T) {
+	r := newTestResource(t)
+	object := testDynamic
+	tests := []struct {
+		name  string
+		value tftypes.Value
+	}{
+		{
+			name:  "null attribute",
+			value: object(map[string]tftypes.Value{"a": tftypes.NewValue(tftypes.String, nil), "b": testString("x")}),
+		},
+		{
+			name: "null list element",
+			value: object(map[string]tftypes.Value{
+				"l": tftypes.NewValue(tftypes.Tuple{ElementTypes: []tftypes.Type{tftypes.String, tftypes.String}}, []tftypes.Value{testString("x"), tftypes.NewValue(tftypes.String, nil)}),
+			}),
+		},
+		{
+			name: "deeply nested null",
+			value: object(map[string]tftypes.Value{
+				"o": object(map[string]tftypes.Value{"p": object(map[string]tftypes.Value{"q": tftypes.NewValue(tftypes.Number, nil)})}),
+			}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := r.config(map[string]tftypes.Value{"typed_inputs": test.value}, map[string][]map[string]tftypes.Value{
+				"create": {{"cmd": testString("true")}},
+			})
+			if errors := testErrors(r.planCreate(config)); len(errors) > 0 {
+				t.Errorf("unexpected errors: %v", errors)
+			}
+		})
+	}
+}
+
+func TestSortUpdates(t *testing.T) {
+	rule := func(priority int64, triggers ...string) *resourceCommandUpdateModel {
+		return &resourceCommandUpdateModel{Priority: types.Int64Value(priority), Triggers: triggers}
+	}
+	tests := []struct {
+		name  string
+		rules []*resourceCommandUpdateModel
+		want  []string
+	}{
+		{
+			name:  "priority first",
+			rules: []*resourceCommandUpdateModel{rule(1, "a"), rule(0, "b")},
+			want:  []string{"[b]", "[a]"},
+		},
+		{
+			name:  "triggers in any order",
+			rules: []*resourceCommandUpdateModel{rule(0, "c", "a"), rule(0, "b", "a")},
+			want:  []string{"[a, b]", "[a, c]"},
+		},
+		{
+			name:  "rule without triggers",
+			rules: []*resourceCommandUpdateModel{rule(0, "a"), rule(0)},
+			want:  []string{"[*]", "[a]"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Every order of the rules gives the same result
+			for _, rules := range [][]*resourceCommandUpdateModel{test.rules, {test.rules[1], test.rules[0]}} {
+				rules = append([]*resourceCommandUpdateModel(nil), rules...)
+				sortUpdates(rules)
+				var got []string
+				for _, rule := range rules {
+					got = append(got, rule.label())
+				}
+				if strings.Join(got, " ") != strings.Join(test.want, " ") {
+					t.Errorf("got %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanMasksSensitiveValues(t *testing.T) {
+	r := newTestResource(t)
+	config := r.config(
+		map[string]tftypes.Value{
+			"sensitive_inputs": tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{"password": testString("hunter2")}),
+		},
+		map[string][]map[string]tftypes.Value{
+			"create":    {{"cmd": testString("true")}},
+			"preflight": {{"cmd": testString(`echo "password: $INPUT_password"; exit 1`)}},
+		},
+	)
+
+	errors := testErrors(r.planCreate(config))
+	if len(errors) != 1 || !strings.Contains(errors[0], "password: ***") || strings.Contains(errors[0], "hunter2") {
+		t.Errorf("expected a redacted preflight error, got %v", errors)
+	}
+}
+
+func TestPlanUnknownConnection(t *testing.T) {
+	r := newTestResourceType(t, "cmd_ssh")
+	connectionType := r.typ.AttributeTypes["connection"].(tftypes.Object)
+	unknown := tftypes.NewValue(tftypes.String, tftypes.UnknownValue)
+	tests := []struct {
+		name       string
+		connection tftypes.Value
+	}{
+		{name: "unknown connection", connection: tftypes.NewValue(connectionType, tftypes.UnknownValue)},
+		{name: "unknown hostname", connection: testObject(connectionType, map[string]tftypes.Value{"hostname": unknown})},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := r.config(map[string]tftypes.Value{"connection": test.connection}, map[string][]map[string]tftypes.Value{
+				"create":    {{"cmd": testString("true")}},
+				"preflight": {{"cmd": testString("exit 1")}},
+			})
+			if errors := testErrors(r.planCreate(config)); len(errors) > 0 {
+				t.Errorf("the preflight should be skipped, got %v", errors)
+			}
+		})
+	}
+}
+
+func TestPlanMasksSensitivePredictions(t *testing.T) {
+	r := newTestResource(t)
+	readType := r.typ.AttributeTypes["read"].(tftypes.Set).ElementType.(tftypes.Object)
+	plan := func(cmd string) tftypes.Value {
+		planType := readType.AttributeTypes["plan"].(tftypes.List)
+		return tftypes.NewValue(planType, []tftypes.Value{testObject(planType.ElementType.(tftypes.Object), map[string]tftypes.Value{"cmd": testString(cmd)})})
+	}
+	dependsOn := tftypes.NewValue(readType.AttributeTypes["depends_on_reads"], []tftypes.Value{testString("a")})
+	config := r.config(nil, map[string][]map[string]tftypes.Value{
+		"create": {{"cmd": testString("true")}},
+		"read": {
+			{"name": testString("a"), "cmd": testString("true"), "sensitive": tftypes.NewValue(tftypes.Bool, true), "plan": plan("echo s3cret")},
+			{"name": testString("b"), "cmd": testString("true"), "depends_on_reads": dependsOn, "plan": plan(`echo "::warning::got $READ_a"`)},
+		},
+	})
+
+	resp, err := r.server.PlanResourceChange(context.Background(), &tfprotov6.PlanResourceChangeRequest{
+		TypeName:         r.name,
+		Config:           r.dynamic(config),
+		ProposedNewState: r.dynamic(config),
+		PriorState:       r.dynamic(tftypes.NewValue(r.typ, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	warned := false
+	for _, d := range resp.Diagnostics {
+		if strings.Contains(d.Detail, "s3cret") {
+			t.Errorf("secret in the diagnostics: %s", d.Detail)
+		}
+		if d.Detail == "got ***" {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Errorf("the plan of b has not been run: %v", resp.Diagnostics)
+	}
+}
+
+func TestGetUpdates(t *testing.T) {
+	rule := func(priority int64, triggers ...string) resourceCommandUpdateModel {
+		return resourceCommandUpdateModel{Priority: types.Int64Value(priority), Triggers: triggers}
+	}
+	inputs := func(values map[string]string) map[string]types.String {
+		m := make(map[string]types.String)
+		for k, v := range values {
+			m[k] = types.StringValue(v)
+		}
+		return m
+	}
+	state := inputs(map[string]string{"a": "1", "b": "1", "c": "1", "z": "1"})
+	tests := []struct {
+		name     string
+		strategy string
+		rules    []resourceCommandUpdateModel
+		replace  []string
+		ignore   []string
+		modified []string
+		// want lists the labels of the selected rules, nil if the resource is replaced
+		want []string
+	}{
+		{
+			name:     "minimal smallest superset",
+			rules:    []resourceCommandUpdateModel{rule(0, "a", "b", "c"), rule(0, "a", "b"), rule(0, "a")},
+			modified: []string{"a", "b"},
+			want:     []string{"[a, b]"},
+		},
+		{
+			name:     "minimal without matching rule",
+			rules:    []resourceCommandUpdateModel{rule(0, "a")},
+			modified: []string{"b"},
+		},
+		{
+			name:     "minimal fallback",
+			rules:    []resourceCommandUpdateModel{rule(0, "a"), rule(0)},
+			modified: []string{"z"},
+			want:     []string{"[*]"},
+		},
+		{
+			name:     "minimal fallback not needed",
+			rules:    []resourceCommandUpdateModel{rule(0), rule(0, "a")},
+			modified: []string{"a"},
+			want:     []string{"[a]"},
+		},
+		{
+			name:     "compose overlapping triggers",
+			strategy: "compose",
+			rules:    []resourceCommandUpdateModel{rule(1, "a", "b"), rule(0, "b", "c"), rule(0, "z")},
+			modified: []string{"b"},
+			want:     []string{"[b, c]", "[a, b]"},
+		},
+		{
+			name:     "compose several inputs",
+			strategy: "compose",
+			rules:    []resourceCommandUpdateModel{rule(0, "a"), rule(0, "b*"), rule(0, "c")},
+			modified: []string{"a", "b"},
+			want:     []string{"[a]", "[b*]"},
+		},
+		{
+			name:     "compose fallback not needed",
+			strategy: "compose",
+			rules:    []resourceCommandUpdateModel{rule(0), rule(0, "a")},
+			modified: []string{"a"},
+			want:     []string{"[a]"},
+		},
+		{
+			name:     "compose fallback for unmatched inputs",
+			strategy: "compose",
+			rules:    []resourceCommandUpdateModel{rule(0), rule(0, "a")},
+			modified: []string{"a", "z"},
+			want:     []string{"[*]", "[a]"},
+		},
+		{
+			name:     "compose without fallback",
+			strategy: "compose",
+			rules:    []resourceCommandUpdateModel{rule(0, "a")},
+			modified: []string{"a", "z"},
+		},
+		{
+			name:     "replace_on overrides an update",
+			rules:    []resourceCommandUpdateModel{rule(0, "a"), rule(0)},
+			replace:  []string{"a"},
+			modified: []string{"a"},
+		},
+		{
+			name:     "replace_on with composed updates",
+			strategy: "compose",
+			rules:    []resourceCommandUpdateModel{rule(0, "a"), rule(0, "b")},
+			replace:  []string{"/[bc]/"},
+			modified: []string{"a", "b"},
+		},
+		{
+			name:     "replace_on takes precedence over ignore_changes_of",
+			rules:    []resourceCommandUpdateModel{rule(0)},
+			replace:  []string{"a*"},
+			ignore:   []string{"a"},
+			modified: []string{"a"},
+		},
+		{
+			name:     "replace_on of another input",
+			rules:    []resourceCommandUpdateModel{rule(0, "a")},
+			replace:  []string{"b"},
+			modified: []string{"a"},
+			want:     []string{"[a]"},
+		},
+		{
+			name:     "ignore_changes_of suppresses a diff",
+			rules:    []resourceCommandUpdateModel{rule(0, "b")},
+			ignore:   []string{"a"},
+			modified: []string{"a"},
+			want:     []string{},
+		},
+		{
+			name:     "ignore_changes_of among other changes",
+			rules:    []resourceCommandUpdateModel{rule(0, "b")},
+			ignore:   []string{"a", "c"},
+			modified: []string{"a", "b"},
+			want:     []string{"[b]"},
+		},
+		{
+			name:     "ignore_changes_of with composed updates",
+			strategy: "compose",
+			rules:    []resourceCommandUpdateModel{rule(0, "b")},
+			ignore:   []string{"*"},
+			modified: []string{"a", "b"},
+			want:     []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			model := resourceCommandModel{
+				Update:          test.rules,
+				UpdateStrategy:  types.StringNull(),
+				ReplaceOn:       test.replace,
+				IgnoreChangesOf: test.ignore,
+			}
+			if test.strategy != "" {
+				model.UpdateStrategy = types.StringValue(test.strategy)
+			}
+			plan := mergeMaps(state)
+			for _, key := range test.modified {
+				plan[key] = types.StringValue("2")
+			}
+
+			updates := model.get_updates(state, plan)
+			if test.want == nil {
+				if updates != nil {
+					t.Errorf("expected a replacement, got %d rules", len(updates))
+				}
+				return
+			}
+			if updates == nil {
+				t.Fatalf("unexpected replacement")
+			}
+			got := []string{}
+			for _, update := range updates {
+				got = append(got, update.label())
+			}
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPlanUpdateReplace(t *testing.T) {
+	r := newTestResource(t)
+	set := func(values ...string) tftypes.Value {
+		var elems []tftypes.Value
+		for _, v := range values {
+			elems = append(elems, testString(v))
+		}
+		return tftypes.NewValue(tftypes.Set{ElementType: tftypes.String}, elems)
+	}
+	inputs := func(a string, b string) tftypes.Value {
+		return tftypes.NewValue(r.typ.AttributeTypes["inputs"], map[string]tftypes.Value{"a": testString(a), "b": testString(b)})
+	}
+	tests := []struct {
+		name        string
+		attrs       map[string]tftypes.Value
+		updates     []map[string]tftypes.Value
+		a           string
+		b           string
+		wantReplace bool
+	}{
+		{
+			name:    "matching update",
+			updates: []map[string]tftypes.Value{{"triggers": set("a"), "cmd": testString("true")}},
+			a:       "2",
+			b:       "1",
+		},
+		{
+			name:        "no matching update",
+			updates:     []map[string]tftypes.Value{{"triggers": set("a"), "cmd": testString("true")}},
+			a:           "1",
+			b:           "2",
+			wantReplace: true,
+		},
+		{
+			name:        "composed updates without fallback",
+			attrs:       map[string]tftypes.Value{"update_strategy": testString("compose")},
+			updates:     []map[string]tftypes.Value{{"triggers": set("a"), "cmd": testString("true")}},
+			a:           "2",
+			b:           "2",
+			wantReplace: true,
+		},
+		{
+			name:  "composed updates with fallback",
+			attrs: map[string]tftypes.Value{"update_strategy": testString("compose")},
+			updates: []map[string]tftypes.Value{
+				{"triggers": set("a"), "cmd": testString("true")},
+				{"cmd": testString("true")},
+			},
+			a: "2",
+			b: "2",
+		},
+		{
+			name:        "replace_on",
+			attrs:       map[string]tftypes.Value{"replace_on": set("a")},
+			updates:     []map[string]tftypes.Value{{"triggers": set("a"), "cmd": testString("true")}},
+			a:           "2",
+			b:           "1",
+			wantReplace: true,
+		},
+		{
+			name:  "ignore_changes_of",
+			attrs: map[string]tftypes.Value{"ignore_changes_of": set("b")},
+			a:     "1",
+			b:     "2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := func(a string, b string) tftypes.Value {
+				attrs := map[string]tftypes.Value{"inputs": inputs(a, b)}
+				for k, v := range test.attrs {
+					attrs[k] = v
+				}
+				return r.config(attrs, map[string][]map[string]tftypes.Value{
+					"create": {{"cmd": testString("true")}},
+					"update": test.updates,
+				})
+			}
+			resp := r.planUpdate(config("1", "1"), config(test.a, test.b))
+			replace := false
+			for _, p := range resp.RequiresReplace {
+				if p.Equal(tftypes.NewAttributePath().WithAttributeName("inputs")) {
+					replace = true
+				}
+			}
+			if replace != test.wantReplace {
+				t.Errorf("replace is %t, want %t (requires replace: %v)", replace, test.wantReplace, resp.RequiresReplace)
+			}
+		})
+	}
+}
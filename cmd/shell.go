@@ -2,6 +2,13 @@ package cmd
 
 import (
   "context"
+  "errors"
+  "io"
+  "os/exec"
+  "strings"
+  "syscall"
+
+  "golang.org/x/crypto/ssh"
 
   "github.com/hashicorp/terraform-plugin-framework/diag"
   "github.com/hashicorp/terraform-plugin-framework/tfsdk"
@@ -9,15 +16,50 @@ import (
 )
 
 type shell interface {
-  Execute(string, map[string]string) (string, string, string, error)
-  //Send(string, []byte) error
+  Execute(string, map[string]string, io.Reader, *CommandOutput) error
+  Host() string
+  // TempDir creates a temporary directory, only accessible by the user, and returns its path
+  TempDir() (string, error)
+  // Send writes a file, only accessible by the user
+  Send(string, []byte) error
   //Receive(string) ([]byte, error)
+  RemoveAll(string) error
   Close()
 }
 
+// shellQuote quotes a string so that it is a single word for the shell.
+func shellQuote(s string) string {
+  return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 type shellFactory struct {
   IsRemote bool
   Name string
   Schema map[string]tfsdk.Attribute
   Create func(context.Context, types.Object) (shell, diag.Diagnostics)
 }
+
+// exitStatus extracts the exit status of a command from the error returned by shell.Execute.
+// The error is returned as-is, with the signal that killed the command if any, if the command could not run until completion.
+func exitStatus(err error) (int, string, error) {
+  if err == nil {
+    return 0, "", nil
+  }
+  var localErr *exec.ExitError
+  if errors.As(err, &localErr) {
+    if localErr.Exited() {
+      return localErr.ExitCode(), "", nil
+    }
+    if status, ok := localErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+      return -1, status.Signal().String(), err
+    }
+  }
+  var sshErr *ssh.ExitError
+  if errors.As(err, &sshErr) {
+    if sshErr.Signal() == "" {
+      return sshErr.ExitStatus(), "", nil
+    }
+    return -1, sshErr.Signal(), err
+  }
+  return -1, "", err
+}
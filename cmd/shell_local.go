@@ -3,6 +3,8 @@ package cmd
 import (
   "context"
   "fmt"
+  "io"
+  "os"
   "os/exec"
 
   "github.com/hashicorp/terraform-plugin-framework/diag"
@@ -33,7 +35,7 @@ type shellLocal struct {
   args []string
 }
 
-func (sh shellLocal) Execute(command string, env map[string]string) (string, string, string, error) {
+func (sh shellLocal) Execute(command string, env map[string]string, stdin io.Reader, out *CommandOutput) error {
   if len(sh.args) == 0 {
     sh.args = []string{"sh", "-c", command}
   } else {
@@ -46,13 +48,22 @@ func (sh shellLocal) Execute(command string, env map[string]string) (string, str
     cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
   }
 
-  out := NewCommandOutput()
-
+  cmd.Stdin = stdin
   cmd.Stdout = out.StdoutWriter
   cmd.Stderr = out.StderrWriter
 
-  err := cmd.Run()
-
-  return out.Stdout.String(), out.Stderr.String(), out.Combined.String(), err
+  return cmd.Run()
+}
+func (_ shellLocal) Host() string {
+  return "localhost"
+}
+func (_ shellLocal) TempDir() (string, error) {
+  return os.MkdirTemp("", "terraform-provider-cmd-*")
+}
+func (_ shellLocal) Send(path string, content []byte) error {
+  return os.WriteFile(path, content, 0600)
+}
+func (_ shellLocal) RemoveAll(path string) error {
+  return os.RemoveAll(path)
 }
 func (_ shellLocal) Close() {}
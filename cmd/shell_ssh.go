@@ -1,11 +1,14 @@
 package cmd
 
 import (
+  "bytes"
   "context"
   "fmt"
   "encoding/pem"
   "crypto/x509"
+  "io"
   "io/ioutil"
+  "strings"
 
 	"golang.org/x/crypto/ssh"
 
@@ -170,13 +173,13 @@ var shellSshFactory shellFactory = shellFactory{
   },
 }
 
-func (sh *shellSsh) Execute(command string, env map[string]string) (string, string, string, error) {
-  out := NewCommandOutput()
+func (sh *shellSsh) Execute(command string, env map[string]string, stdin io.Reader, out *CommandOutput) error {
   session, err := sh.client.NewSession()
   if err != nil {
-    return "", "", "", err
+    return err
   }
   defer session.Close()
+  session.Stdin = stdin
   session.Stdout = out.StdoutWriter
   session.Stderr = out.StderrWriter
 
@@ -190,9 +193,40 @@ func (sh *shellSsh) Execute(command string, env map[string]string) (string, stri
   }
   cmd += command
 
-  err = session.Run(cmd)
+  return session.Run(cmd)
+}
 
-  return out.Stdout.String(), out.Stderr.String(), out.Combined.String(), err
+func (sh *shellSsh) Host() string {
+  return sh.client.RemoteAddr().String()
+}
+func (sh *shellSsh) TempDir() (string, error) {
+  session, err := sh.client.NewSession()
+  if err != nil {
+    return "", err
+  }
+  defer session.Close()
+  dir, err := session.Output("mktemp -d")
+  if err != nil {
+    return "", err
+  }
+  return strings.TrimRight(string(dir), "\n"), nil
+}
+func (sh *shellSsh) Send(path string, content []byte) error {
+  session, err := sh.client.NewSession()
+  if err != nil {
+    return err
+  }
+  defer session.Close()
+  session.Stdin = bytes.NewReader(content)
+  return session.Run(fmt.Sprintf("umask 077 && cat > %s", shellQuote(path)))
+}
+func (sh *shellSsh) RemoveAll(path string) error {
+  session, err := sh.client.NewSession()
+  if err != nil {
+    return err
+  }
+  defer session.Close()
+  return session.Run(fmt.Sprintf("rm -rf -- %s", shellQuote(path)))
 }
 
 func (sh *shellSsh) Close() {
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+  "bufio"
+  "encoding/json"
+  "fmt"
+  "strings"
+)
+
+const stateOutputMarker = "__!@#$STATE_OUTPUT$#@!__"
+
+// wrapStateOutputCommand wraps a command so that it can write its state into the file $STATE_OUTPUT.
+// The content of the file is appended to stdout after a marker line, so that it can be retrieved
+// within the same execution, whether the shell is local or remote.
+func wrapStateOutputCommand(command string) string {
+  return fmt.Sprintf(
+    "STATE_OUTPUT=\"$(mktemp)\" || exit 1\nexport STATE_OUTPUT\n(\n%s\n)\n__STATUS=$?\nprintf '\\n%s\\n'\ncat \"$STATE_OUTPUT\"\nrm -f \"$STATE_OUTPUT\"\nexit $__STATUS\n",
+    command,
+    stateOutputMarker,
+  )
+}
+
+// splitStateOutput separates the regular stdout of a wrapped command from the content of $STATE_OUTPUT.
+func splitStateOutput(stdout string) (string, string, error) {
+  marker := "\n" + stateOutputMarker + "\n"
+  i := strings.LastIndex(stdout, marker)
+  if i < 0 {
+    return stdout, "", fmt.Errorf("STATE_OUTPUT content has not been found in the command output")
+  }
+  return stdout[:i], stdout[i+len(marker):], nil
+}
+
+// parseStateOutput parses the content of a $STATE_OUTPUT file.
+// Each line is either:
+//   - name=value
+//   - name<<DELIMITER followed by a multiline value ended by a DELIMITER line
+//   - a JSON object whose fields are the names of the variables
+func parseStateOutput(content string) (map[string]string, error) {
+  values := make(map[string]string)
+  scanner := bufio.NewScanner(strings.NewReader(content))
+  scanner.Buffer(nil, len(content)+1)
+  lineno := 0
+
+  for scanner.Scan() {
+    line := scanner.Text()
+    lineno += 1
+
+    if strings.TrimSpace(line) == "" {
+      continue
+    }
+
+    if strings.HasPrefix(strings.TrimSpace(line), "{") {
+      var obj map[string]any
+      if err := json.Unmarshal([]byte(line), &obj); err != nil {
+        return nil, fmt.Errorf("STATE_OUTPUT line %d: invalid JSON: %s", lineno, err)
+      }
+      for k, v := range obj {
+        if s, ok := v.(string); ok {
+          values[k] = s
+        } else {
+          b, _ := json.Marshal(v)
+          values[k] = string(b)
+        }
+      }
+      continue
+    }
+
+    eq := strings.Index(line, "=")
+    heredoc := strings.Index(line, "<<")
+    if heredoc >= 0 && (eq < 0 || heredoc < eq) {
+      name := line[:heredoc]
+      delimiter := line[heredoc+2:]
+      if name == "" || delimiter == "" {
+        return nil, fmt.Errorf("STATE_OUTPUT line %d: invalid multiline declaration", lineno)
+      }
+      var lines []string
+      closed := false
+      for scanner.Scan() {
+        lineno += 1
+        if scanner.Text() == delimiter {
+          closed = true
+          break
+        }
+        lines = append(lines, scanner.Text())
+      }
+      if !closed {
+        return nil, fmt.Errorf("STATE_OUTPUT: missing delimiter %s for variable %s", delimiter, name)
+      }
+      values[name] = strings.Join(lines, "\n")
+    } else if eq > 0 {
+      values[line[:eq]] = line[eq+1:]
+    } else {
+      return nil, fmt.Errorf("STATE_OUTPUT line %d: expected name=value, name<<DELIMITER or a JSON object", lineno)
+    }
+  }
+
+  if err := scanner.Err(); err != nil {
+    return nil, err
+  }
+
+  return values, nil
+}
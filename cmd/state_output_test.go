@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStateOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			content: "",
+			want:    map[string]string{},
+		},
+		{
+			name:    "name=value",
+			content: "a=1\nb=two\n",
+			want:    map[string]string{"a": "1", "b": "two"},
+		},
+		{
+			name:    "value with equal signs",
+			content: "a=b=c\n",
+			want:    map[string]string{"a": "b=c"},
+		},
+		{
+			name:    "empty value",
+			content: "a=\n",
+			want:    map[string]string{"a": ""},
+		},
+		{
+			name:    "blank lines",
+			content: "\na=1\n   \nb=2",
+			want:    map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:    "last value wins",
+			content: "a=1\na=2\n",
+			want:    map[string]string{"a": "2"},
+		},
+		{
+			name:    "multiline",
+			content: "a<<EOF\nline 1\nline=2\n\nEOF\nb=3\n",
+			want:    map[string]string{"a": "line 1\nline=2\n", "b": "3"},
+		},
+		{
+			name:    "heredoc marker inside a value",
+			content: "a=x<<y\n",
+			want:    map[string]string{"a": "x<<y"},
+		},
+		{
+			name:    "empty multiline",
+			content: "a<<EOF\nEOF\n",
+			want:    map[string]string{"a": ""},
+		},
+		{
+			name:    "json",
+			content: `{"a": "1", "b": 2, "c": true, "d": null, "e": {"f": [1, "g"]}}`,
+			want:    map[string]string{"a": "1", "b": "2", "c": "true", "d": "null", "e": `{"f":[1,"g"]}`},
+		},
+		{
+			name:    "json and name=value",
+			content: "{\"a\": \"1\"}\nb=2\n",
+			want:    map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:    "missing delimiter",
+			content: "a<<EOF\nline\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			content: "<<EOF\nline\nEOF\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing delimiter name",
+			content: "a<<\nline\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing equal sign",
+			content: "a\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty name",
+			content: "=1\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			content: "{\"a\": 1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseStateOutput(test.content)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitStateOutput(t *testing.T) {
+	marker := "\n" + stateOutputMarker + "\n"
+	tests := []struct {
+		name       string
+		stdout     string
+		wantStdout string
+		wantState  string
+		wantErr    bool
+	}{
+		{
+			name:       "no stdout",
+			stdout:     marker + "a=1\n",
+			wantStdout: "",
+			wantState:  "a=1\n",
+		},
+		{
+			name:       "stdout and state",
+			stdout:     "hello\n" + marker + "a=1\n",
+			wantStdout: "hello\n",
+			wantState:  "a=1\n",
+		},
+		{
+			name:       "marker printed by the command",
+			stdout:     "hello" + marker + "fake\n" + marker + "a=1\n",
+			wantStdout: "hello" + marker + "fake\n",
+			wantState:  "a=1\n",
+		},
+		{
+			name:    "missing marker",
+			stdout:  "hello\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, state, err := splitStateOutput(test.stdout)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if stdout != test.wantStdout || state != test.wantState {
+				t.Errorf("got (%q, %q), want (%q, %q)", stdout, state, test.wantStdout, test.wantState)
+			}
+		})
+	}
+}
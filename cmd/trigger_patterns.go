@@ -0,0 +1,180 @@
+package cmd
+
+import (
+  "context"
+  "fmt"
+  pathpkg "path"
+  "regexp"
+  "strings"
+
+  "github.com/hashicorp/terraform-plugin-framework/tfsdk"
+  "github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Update triggers are patterns matching input paths, whose segments are separated by dots:
+//   - a literal like `user_alice` or `users.0.name`
+//   - a glob like `user_*` or `users.*.name`, whose wildcards `*`, `?` and `[...]` do not cross dots
+//   - a regex between slashes like `/user_(alice|bob)/`, matched against whole paths
+// A trigger also matches every path below the ones it matches, so that `users` matches `users.0.name`.
+
+// isRegexTrigger returns whether a trigger is a regex between slashes.
+func isRegexTrigger(trigger string) bool {
+  return len(trigger) >= 2 && strings.HasPrefix(trigger, "/") && strings.HasSuffix(trigger, "/")
+}
+
+// isLiteralTrigger returns whether a trigger matches only a single path.
+func isLiteralTrigger(trigger string) bool {
+  return !isRegexTrigger(trigger) && !strings.ContainsAny(trigger, "*?[\\")
+}
+
+// literalTriggers returns whether all the triggers of a rule are literals.
+// Such a rule is preferred over a rule with patterns that has as many triggers.
+func literalTriggers(triggers []string) bool {
+  for _, trigger := range triggers {
+    if !isLiteralTrigger(trigger) {
+      return false
+    }
+  }
+  return true
+}
+
+// compileRegexTrigger compiles a regex trigger, anchored so that it matches whole paths.
+func compileRegexTrigger(trigger string) (*regexp.Regexp, error) {
+  return regexp.Compile("^(?:" + trigger[1:len(trigger)-1] + ")$")
+}
+
+// matchInputPath checks if a trigger matches an input path, or one of its ancestors.
+func matchInputPath(trigger string, key string) bool {
+  segments := strings.Split(key, ".")
+
+  if isRegexTrigger(trigger) {
+    re, err := compileRegexTrigger(trigger)
+    if err != nil {
+      return false
+    }
+    for i := range segments {
+      if re.MatchString(strings.Join(segments[:i+1], ".")) {
+        return true
+      }
+    }
+    return false
+  }
+
+  patterns := strings.Split(trigger, ".")
+  if len(patterns) > len(segments) {
+    return false
+  }
+  for i, pattern := range patterns {
+    if matched, err := pathpkg.Match(pattern, segments[i]); err != nil || !matched {
+      return false
+    }
+  }
+  return true
+}
+
+// literalPrefix returns the part of a glob segment before its first wildcard.
+func literalPrefix(pattern string) string {
+  if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+    return pattern[:i]
+  }
+  return pattern
+}
+
+// literalSuffix returns the part of a glob segment after its last wildcard.
+func literalSuffix(pattern string) string {
+  if i := strings.LastIndexAny(pattern, "*?]\\"); i >= 0 {
+    return pattern[i+1:]
+  }
+  return pattern
+}
+
+// segmentsOverlap checks if two glob segments may match the same segment.
+// Between two globs, only their literal prefixes and suffixes are compared, so the answer may be a false positive.
+func segmentsOverlap(a string, b string) bool {
+  if isLiteralTrigger(a) {
+    matched, _ := pathpkg.Match(b, a)
+    return matched
+  }
+  if isLiteralTrigger(b) {
+    matched, _ := pathpkg.Match(a, b)
+    return matched
+  }
+  prefixA, prefixB := literalPrefix(a), literalPrefix(b)
+  suffixA, suffixB := literalSuffix(a), literalSuffix(b)
+  return (strings.HasPrefix(prefixA, prefixB) || strings.HasPrefix(prefixB, prefixA)) &&
+    (strings.HasSuffix(suffixA, suffixB) || strings.HasSuffix(suffixB, suffixA))
+}
+
+// triggersOverlap checks statically if a change could be matched by both triggers.
+// Regexes can only be compared with literals, so they are assumed not to overlap with other regexes and globs.
+func triggersOverlap(a string, b string) bool {
+  if a == b {
+    return true
+  }
+  if isRegexTrigger(b) {
+    a, b = b, a
+  }
+  if isRegexTrigger(a) {
+    return isLiteralTrigger(b) && matchInputPath(a, b)
+  }
+  // As triggers match the paths below them, only the common depth is compared
+  patternsA, patternsB := strings.Split(a, "."), strings.Split(b, ".")
+  for i := 0; i < len(patternsA) && i < len(patternsB); i++ {
+    if !segmentsOverlap(patternsA[i], patternsB[i]) {
+      return false
+    }
+  }
+  return true
+}
+
+// overlappingTriggers splits the triggers of a rule between those that overlap some trigger of another rule, and the others.
+func overlappingTriggers(triggers []string, others []string) (overlapping []string, rest []string) {
+  for _, trigger := range triggers {
+    found := false
+    for _, other := range others {
+      if triggersOverlap(trigger, other) {
+        found = true
+        break
+      }
+    }
+    if found {
+      overlapping = append(overlapping, trigger)
+    } else {
+      rest = append(rest, trigger)
+    }
+  }
+  return
+}
+
+type triggerPatternValidator struct {}
+
+func (_ triggerPatternValidator) Description(ctx context.Context) string {
+  return "Validates the syntax of an update trigger"
+}
+func (_ triggerPatternValidator) MarkdownDescription(ctx context.Context) string {
+  return "Validates the syntax of an update trigger"
+}
+func (_ triggerPatternValidator) Validate(ctx context.Context, req tfsdk.ValidateAttributeRequest, resp *tfsdk.ValidateAttributeResponse) {
+  value, ok := req.AttributeConfig.(types.String)
+  if !ok || value.IsNull() || value.IsUnknown() {
+    return
+  }
+  trigger := value.ValueString()
+
+  if isRegexTrigger(trigger) {
+    if _, err := compileRegexTrigger(trigger); err != nil {
+      resp.Diagnostics.AddAttributeError(req.AttributePath, "Invalid trigger", fmt.Sprintf("%s is not a valid regex: %s", trigger, err))
+    }
+    return
+  }
+  for _, segment := range strings.Split(trigger, ".") {
+    if segment == "" {
+      resp.Diagnostics.AddAttributeError(req.AttributePath, "Invalid trigger", fmt.Sprintf("%s has an empty path segment", trigger))
+      return
+    }
+    if _, err := pathpkg.Match(segment, ""); err != nil {
+      resp.Diagnostics.AddAttributeError(req.AttributePath, "Invalid trigger", fmt.Sprintf("%s is not a valid glob: %s", trigger, err))
+      return
+    }
+  }
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchInputPath(t *testing.T) {
+	tests := []struct {
+		trigger string
+		key     string
+		want    bool
+	}{
+		// Literals
+		{"a", "a", true},
+		{"a", "b", false},
+		{"a", "ab", false},
+		{"users", "users.0.name", true},
+		{"users.0", "users.0.name", true},
+		{"users.0.name", "users.0", false},
+		{"users.1", "users.10", false},
+		// Globs
+		{"user_*", "user_alice", true},
+		{"user_*", "user_", true},
+		{"user_*", "users", false},
+		{"user_*", "user_alice.name", true},
+		{"users.*.name", "users.0.name", true},
+		{"users.*.name", "users.0.email", false},
+		{"users.*", "users", false},
+		{"*", "a.b.c", true},
+		{"user_?", "user_a", true},
+		{"user_?", "user_ab", false},
+		{"user_[ab]", "user_b", true},
+		{"user_[ab]", "user_c", false},
+		// Wildcards do not cross dots
+		{"a*c", "ab.c", false},
+		{"a*", "b.a", false},
+		// Globs match ancestors too
+		{"users*", "users.0", true},
+		// Regexes match whole paths
+		{"/user_(alice|bob)/", "user_alice", true},
+		{"/user_(alice|bob)/", "user_carol", false},
+		{"/user/", "user_alice", false},
+		{"/user_.*/", "user_alice.name", true},
+		{"/users\\.[0-9]+/", "users.12.name", true},
+		{"/users\\.[0-9]+/", "users.x", false},
+		{"/[/", "[", false},
+	}
+
+	for _, test := range tests {
+		if got := matchInputPath(test.trigger, test.key); got != test.want {
+			t.Errorf("matchInputPath(%q, %q) = %t, want %t", test.trigger, test.key, got, test.want)
+		}
+	}
+}
+
+func TestTriggerKinds(t *testing.T) {
+	tests := []struct {
+		trigger     string
+		wantRegex   bool
+		wantLiteral bool
+	}{
+		{"a", false, true},
+		{"users.0.name", false, true},
+		{"user_*", false, false},
+		{"user_?", false, false},
+		{"user_[ab]", false, false},
+		{"user_\\*", false, false},
+		{"/a/", true, false},
+		{"//", true, false},
+		{"/", false, true},
+		{"/a", false, true},
+	}
+
+	for _, test := range tests {
+		if got := isRegexTrigger(test.trigger); got != test.wantRegex {
+			t.Errorf("isRegexTrigger(%q) = %t, want %t", test.trigger, got, test.wantRegex)
+		}
+		if got := isLiteralTrigger(test.trigger); got != test.wantLiteral {
+			t.Errorf("isLiteralTrigger(%q) = %t, want %t", test.trigger, got, test.wantLiteral)
+		}
+	}
+	if !literalTriggers([]string{"a", "b.c"}) || literalTriggers([]string{"a", "b*"}) || !literalTriggers(nil) {
+		t.Errorf("literalTriggers does not check every trigger")
+	}
+}
+
+func TestTriggersOverlap(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		// Literals
+		{"a", "a", true},
+		{"a", "b", false},
+		{"users", "users.0", true},
+		{"users.0", "users.1", false},
+		// Globs against literals
+		{"user_*", "user_alice", true},
+		{"user_*", "admin", false},
+		{"users.*.name", "users.0", true},
+		{"users.*.name", "users.0.email", false},
+		{"users.*", "users", true},
+		// Globs against globs
+		{"user_*", "user_a*", true},
+		{"user_*", "admin_*", false},
+		{"*_id", "*_name", false},
+		{"a*", "*b", true},
+		{"users.*.name", "users.0.*", true},
+		{"users.*.name", "users.*.email", false},
+		// Regexes are only compared with literals
+		{"/user_(alice|bob)/", "user_bob", true},
+		{"/user_(alice|bob)/", "user_carol", false},
+		{"/user_.*/", "user_alice.name", true},
+		{"/user_.*/", "user_*", false},
+		{"/a/", "/a|b/", false},
+		{"/a/", "/a/", true},
+	}
+
+	for _, test := range tests {
+		if got := triggersOverlap(test.a, test.b); got != test.want {
+			t.Errorf("triggersOverlap(%q, %q) = %t, want %t", test.a, test.b, got, test.want)
+		}
+		if got := triggersOverlap(test.b, test.a); got != test.want {
+			t.Errorf("triggersOverlap(%q, %q) = %t, want %t", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestOverlappingTriggers(t *testing.T) {
+	overlapping, rest := overlappingTriggers([]string{"a", "user_*", "b.c"}, []string{"user_alice", "b"})
+	if !reflect.DeepEqual(overlapping, []string{"user_*", "b.c"}) || !reflect.DeepEqual(rest, []string{"a"}) {
+		t.Errorf("got %v and %v", overlapping, rest)
+	}
+}
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "math/big"
+  "sort"
+  "strings"
+
+  "github.com/hashicorp/terraform-plugin-framework/attr"
+  "github.com/hashicorp/terraform-plugin-framework/path"
+  "github.com/hashicorp/terraform-plugin-framework/tfsdk"
+  "github.com/hashicorp/terraform-plugin-framework/types"
+  "github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// dynamicType is the type of an attribute accepting any value: its actual type comes from the configuration.
+type dynamicType struct{}
+
+func (t dynamicType) TerraformType(_ context.Context) tftypes.Type {
+  return tftypes.DynamicPseudoType
+}
+func (t dynamicType) ValueFromTerraform(_ context.Context, in tftypes.Value) (attr.Value, error) {
+  return dynamicValue{value: in}, nil
+}
+func (t dynamicType) ValueType(_ context.Context) attr.Value {
+  return dynamicValue{}
+}
+func (t dynamicType) Equal(o attr.Type) bool {
+  _, ok := o.(dynamicType)
+  return ok
+}
+func (t dynamicType) String() string {
+  return "dynamicType"
+}
+// ApplyTerraform5AttributePathStep resolves any step inside a dynamic value to another dynamic value,
+// so that the framework sees a path inside an atomic attribute rather than an attribute missing from the schema.
+func (t dynamicType) ApplyTerraform5AttributePathStep(step tftypes.AttributePathStep) (interface{}, error) {
+  return dynamicType{}, nil
+}
+
+// dynamicValue is a value of dynamicType.
+type dynamicValue struct {
+  value tftypes.Value
+}
+
+func (v dynamicValue) Type(_ context.Context) attr.Type {
+  return dynamicType{}
+}
+func (v dynamicValue) ToTerraformValue(_ context.Context) (tftypes.Value, error) {
+  if v.value.Type() == nil {
+    return tftypes.NewValue(tftypes.DynamicPseudoType, nil), nil
+  }
+  return v.value, nil
+}
+func (v dynamicValue) Equal(o attr.Value) bool {
+  other, ok := o.(dynamicValue)
+  return ok && v.value.Equal(other.value)
+}
+func (v dynamicValue) IsNull() bool {
+  return v.value.Type() == nil || v.value.IsNull()
+}
+func (v dynamicValue) IsUnknown() bool {
+  return v.value.Type() != nil && !v.value.IsKnown()
+}
+func (v dynamicValue) String() string {
+  if v.IsNull() {
+    return attr.NullValueString
+  }
+  if v.IsUnknown() {
+    return attr.UnknownValueString
+  }
+  return v.value.String()
+}
+
+// typedScalar converts a known primitive value into a string.
+func typedScalar(val tftypes.Value) string {
+  switch {
+  case val.Type().Is(tftypes.String):
+    var s string
+    val.As(&s)
+    return s
+  case val.Type().Is(tftypes.Number):
+    var f big.Float
+    val.As(&f)
+    return f.Text('f', -1)
+  case val.Type().Is(tftypes.Bool):
+    var b bool
+    val.As(&b)
+    return fmt.Sprintf("%t", b)
+  default:
+    return ""
+  }
+}
+
+// typedChildren returns the elements of a list, set or tuple, or the attributes of a map or object, by name.
+func typedChildren(val tftypes.Value) (map[string]tftypes.Value, bool) {
+  typ := val.Type()
+  switch {
+  case typ.Is(tftypes.List{}), typ.Is(tftypes.Set{}), typ.Is(tftypes.Tuple{}):
+    var elems []tftypes.Value
+    val.As(&elems)
+    children := make(map[string]tftypes.Value, len(elems))
+    for i, elem := range elems {
+      children[fmt.Sprintf("%d", i)] = elem
+    }
+    return children, true
+  case typ.Is(tftypes.Map{}), typ.Is(tftypes.Object{}):
+    var children map[string]tftypes.Value
+    val.As(&children)
+    return children, true
+  default:
+    return nil, false
+  }
+}
+
+// flattenTyped flattens a value into its leaves, keyed by their path whose segments are separated by dots.
+// Empty collections are leaves holding their JSON encoding.
+func flattenTyped(key string, val tftypes.Value, leaves map[string]types.String) {
+  if !val.IsKnown() {
+    leaves[key] = types.StringUnknown()
+    return
+  }
+  if val.IsNull() {
+    leaves[key] = types.StringNull()
+    return
+  }
+  children, structured := typedChildren(val)
+  if !structured {
+    leaves[key] = types.StringValue(typedScalar(val))
+    return
+  }
+  if len(children) == 0 {
+    leaves[key] = types.StringValue(typedJSON(val))
+    return
+  }
+  for name, child := range children {
+    flattenTyped(key+"."+name, child, leaves)
+  }
+}
+
+// typedAny converts a known value into its JSON representation.
+func typedAny(val tftypes.Value) any {
+  if val.IsNull() || !val.IsKnown() {
+    return nil
+  }
+  typ := val.Type()
+  switch {
+  case typ.Is(tftypes.Number):
+    return json.Number(typedScalar(val))
+  case typ.Is(tftypes.Bool):
+    var b bool
+    val.As(&b)
+    return b
+  case typ.Is(tftypes.List{}), typ.Is(tftypes.Set{}), typ.Is(tftypes.Tuple{}):
+    var elems []tftypes.Value
+    val.As(&elems)
+    list := make([]any, 0, len(elems))
+    for _, elem := range elems {
+      list = append(list, typedAny(elem))
+    }
+    return list
+  case typ.Is(tftypes.Map{}), typ.Is(tftypes.Object{}):
+    var attrs map[string]tftypes.Value
+    val.As(&attrs)
+    obj := make(map[string]any, len(attrs))
+    for name, attr := range attrs {
+      obj[name] = typedAny(attr)
+    }
+    return obj
+  default:
+    return typedScalar(val)
+  }
+}
+
+// typedJSON encodes a known value into JSON.
+func typedJSON(val tftypes.Value) string {
+  b, _ := json.Marshal(typedAny(val))
+  return string(b)
+}
+
+// topLevel returns the inputs of a typed_inputs value, by name.
+func (v dynamicValue) topLevel() map[string]tftypes.Value {
+  if v.IsNull() || v.IsUnknown() {
+    return nil
+  }
+  children, _ := typedChildren(v.value)
+  return children
+}
+
+// leaves returns the flattened typed inputs, keyed by their path like `users.0.name`.
+// If typed_inputs is unknown as a whole, nothing is returned.
+func (v dynamicValue) leaves() map[string]types.String {
+  leaves := make(map[string]types.String)
+  for name, val := range v.topLevel() {
+    flattenTyped(name, val, leaves)
+  }
+  return leaves
+}
+
+// exported returns the typed inputs as given to the commands: scalars as strings, and structured inputs
+// both as JSON and flattened into variables like `users_0_name`.
+func (v dynamicValue) exported() map[string]string {
+  values := make(map[string]string)
+  for name, val := range v.topLevel() {
+    if _, structured := typedChildren(val); structured && !val.IsNull() {
+      values[name] = typedJSON(val)
+    }
+  }
+  for key, leaf := range v.leaves() {
+    values[exportedName(key)] = leaf.ValueString()
+  }
+  return values
+}
+
+// exportedName returns the name of the variable of a flattened typed input, whose dots become underscores.
+func exportedName(key string) string {
+  return strings.ReplaceAll(key, ".", "_")
+}
+
+// exportedCollisions returns the paths of the typed inputs exported into the same variable, by variable name.
+// Like `a_b` and `a.b`, they would silently override each other.
+func (v dynamicValue) exportedCollisions() map[string][]string {
+  paths := make(map[string]map[string]struct{})
+  add := func(name string, key string) {
+    if paths[name] == nil {
+      paths[name] = make(map[string]struct{})
+    }
+    paths[name][key] = struct{}{}
+  }
+  for name, val := range v.topLevel() {
+    if _, structured := typedChildren(val); structured && !val.IsNull() {
+      add(name, name)
+    }
+  }
+  for key := range v.leaves() {
+    add(exportedName(key), key)
+  }
+
+  collisions := make(map[string][]string)
+  for name, keys := range paths {
+    if len(keys) < 2 {
+      continue
+    }
+    for key := range keys {
+      collisions[name] = append(collisions[name], key)
+    }
+    sort.Strings(collisions[name])
+  }
+  return collisions
+}
+
+// contextValues returns the typed inputs as they appear in $CONTEXT_JSON.
+func (v dynamicValue) contextValues() map[string]any {
+  values := make(map[string]any)
+  for name, val := range v.topLevel() {
+    values[name] = typedAny(val)
+  }
+  return values
+}
+
+type typedInputsValidator struct {}
+
+func (_ typedInputsValidator) Description(ctx context.Context) string {
+  return "Validates that typed inputs are an object whose attributes collide neither with inputs nor with each other once exported"
+}
+func (_ typedInputsValidator) MarkdownDescription(ctx context.Context) string {
+  return "Validates that typed inputs are an object whose attributes collide neither with inputs nor with each other once exported"
+}
+func (_ typedInputsValidator) Validate(ctx context.Context, req tfsdk.ValidateAttributeRequest, resp *tfsdk.ValidateAttributeResponse) {
+  typed, ok := req.AttributeConfig.(dynamicValue)
+  if !ok || typed.IsNull() || typed.IsUnknown() {
+    return
+  }
+  if _, structured := typedChildren(typed.value); !structured || typed.value.Type().Is(tftypes.List{}) || typed.value.Type().Is(tftypes.Set{}) || typed.value.Type().Is(tftypes.Tuple{}) {
+    resp.Diagnostics.AddAttributeError(req.AttributePath, "Invalid typed inputs", "typed_inputs must be an object or a map.")
+    return
+  }
+
+  collisions := typed.exportedCollisions()
+  names := make([]string, 0, len(collisions))
+  for name := range collisions {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  for _, name := range names {
+    resp.Diagnostics.AddAttributeError(req.AttributePath, "Invalid typed input", fmt.Sprintf("%s are all exported as %s.", strings.Join(collisions[name], ", "), name))
+  }
+
+  for _, name := range []string{"inputs", "sensitive_inputs"} {
+    var inputs types.Map
+    diags := req.Config.GetAttribute(ctx, path.Root(name), &inputs)
+    if diags.HasError() || inputs.IsNull() || inputs.IsUnknown() {
+      continue
+    }
+    for key := range typed.topLevel() {
+      if _, found := inputs.Elements()[key]; found {
+        resp.Diagnostics.AddAttributeError(req.AttributePath, "Invalid typed input", fmt.Sprintf("%s is already defined in %s.", key, name))
+      }
+    }
+  }
+}
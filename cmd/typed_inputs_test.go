@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// testDynamic builds an object from its attributes, whose type is inferred like typed_inputs.
+func testDynamic(attrs map[string]tftypes.Value) tftypes.Value {
+	attrTypes := make(map[string]tftypes.Type)
+	for name, value := range attrs {
+		attrTypes[name] = value.Type()
+	}
+	return tftypes.NewValue(tftypes.Object{AttributeTypes: attrTypes}, attrs)
+}
+
+func testTuple(elems ...tftypes.Value) tftypes.Value {
+	elemTypes := make([]tftypes.Type, 0, len(elems))
+	for _, elem := range elems {
+		elemTypes = append(elemTypes, elem.Type())
+	}
+	return tftypes.NewValue(tftypes.Tuple{ElementTypes: elemTypes}, elems)
+}
+
+func TestFlattenTyped(t *testing.T) {
+	tests := []struct {
+		name  string
+		value tftypes.Value
+		want  map[string]types.String
+	}{
+		{
+			name:  "string",
+			value: testString("x"),
+			want:  map[string]types.String{"k": types.StringValue("x")},
+		},
+		{
+			name:  "number",
+			value: tftypes.NewValue(tftypes.Number, 1.5),
+			want:  map[string]types.String{"k": types.StringValue("1.5")},
+		},
+		{
+			name:  "bool",
+			value: tftypes.NewValue(tftypes.Bool, true),
+			want:  map[string]types.String{"k": types.StringValue("true")},
+		},
+		{
+			name:  "null",
+			value: tftypes.NewValue(tftypes.String, nil),
+			want:  map[string]types.String{"k": types.StringNull()},
+		},
+		{
+			name:  "unknown",
+			value: tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+			want:  map[string]types.String{"k": types.StringUnknown()},
+		},
+		{
+			name:  "nested",
+			value: testDynamic(map[string]tftypes.Value{"a": testTuple(testString("x"), testDynamic(map[string]tftypes.Value{"b": testString("y")}))}),
+			want:  map[string]types.String{"k.a.0": types.StringValue("x"), "k.a.1.b": types.StringValue("y")},
+		},
+		{
+			name:  "empty collections",
+			value: testDynamic(map[string]tftypes.Value{"l": testTuple(), "o": testDynamic(map[string]tftypes.Value{})}),
+			want:  map[string]types.String{"k.l": types.StringValue("[]"), "k.o": types.StringValue("{}")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			leaves := make(map[string]types.String)
+			flattenTyped("k", test.value, leaves)
+			if !reflect.DeepEqual(leaves, test.want) {
+				t.Errorf("got %v, want %v", leaves, test.want)
+			}
+		})
+	}
+}
+
+func TestTypedInputsExported(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          tftypes.Value
+		want           map[string]string
+		wantCollisions map[string][]string
+	}{
+		{
+			name:  "scalars",
+			value: testDynamic(map[string]tftypes.Value{"a": testString("x"), "n": tftypes.NewValue(tftypes.Number, 2)}),
+			want:  map[string]string{"a": "x", "n": "2"},
+		},
+		{
+			name: "structured",
+			value: testDynamic(map[string]tftypes.Value{
+				"users": testTuple(testDynamic(map[string]tftypes.Value{"name": testString("alice")})),
+			}),
+			want: map[string]string{"users": `[{"name":"alice"}]`, "users_0_name": "alice"},
+		},
+		{
+			name:  "empty collection",
+			value: testDynamic(map[string]tftypes.Value{"l": testTuple()}),
+			want:  map[string]string{"l": "[]"},
+		},
+		{
+			name: "colliding leaves",
+			value: testDynamic(map[string]tftypes.Value{
+				"a_b": tftypes.NewValue(tftypes.Number, 1),
+				"a":   testDynamic(map[string]tftypes.Value{"b": tftypes.NewValue(tftypes.Number, 2)}),
+			}),
+			wantCollisions: map[string][]string{"a_b": {"a.b", "a_b"}},
+		},
+		{
+			name: "leaf colliding with a structured input",
+			value: testDynamic(map[string]tftypes.Value{
+				"a_b": testDynamic(map[string]tftypes.Value{"c": testString("x")}),
+				"a":   testDynamic(map[string]tftypes.Value{"b": testString("y")}),
+			}),
+			wantCollisions: map[string][]string{"a_b": {"a.b", "a_b"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value := dynamicValue{value: test.value}
+			collisions := value.exportedCollisions()
+			if test.wantCollisions == nil {
+				test.wantCollisions = map[string][]string{}
+			}
+			if !reflect.DeepEqual(collisions, test.wantCollisions) {
+				t.Errorf("got collisions %v, want %v", collisions, test.wantCollisions)
+			}
+			if test.want != nil && !reflect.DeepEqual(value.exported(), test.want) {
+				t.Errorf("got %v, want %v", value.exported(), test.want)
+			}
+		})
+	}
+}
+
+func TestTypedInputsValidator(t *testing.T) {
+	r := newTestResource(t)
+	tests := []struct {
+		name    string
+		value   tftypes.Value
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			value: testDynamic(map[string]tftypes.Value{"a": testDynamic(map[string]tftypes.Value{"b": testString("x")}), "c": testString("y")}),
+		},
+		{
+			name:    "not an object",
+			value:   testString("x"),
+			wantErr: "Invalid typed inputs: typed_inputs must be an object or a map.",
+		},
+		{
+			name: "colliding names",
+			value: testDynamic(map[string]tftypes.Value{
+				"a_b": tftypes.NewValue(tftypes.Number, 1),
+				"a":   testDynamic(map[string]tftypes.Value{"b": tftypes.NewValue(tftypes.Number, 2)}),
+			}),
+			wantErr: "Invalid typed input: a.b, a_b are all exported as a_b.",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errors := testErrors(r.validate(r.config(map[string]tftypes.Value{"typed_inputs": test.value}, nil)))
+			if test.wantErr == "" && len(errors) > 0 {
+				t.Errorf("unexpected errors: %v", errors)
+			}
+			if test.wantErr != "" && (len(errors) != 1 || errors[0] != test.wantErr) {
+				t.Errorf("got %v, want %q", errors, test.wantErr)
+			}
+		})
+	}
+}
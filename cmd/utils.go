@@ -54,3 +54,13 @@ func transform[F ~func(U) V, U any, V any](arr []U, f F) []V {
   }
   return r
 }
+
+func mergeMaps[K comparable, V any](maps ...map[K]V) map[K]V {
+  r := make(map[K]V)
+  for _, m := range maps {
+    for k, v := range m {
+      r[k] = v
+    }
+  }
+  return r
+}
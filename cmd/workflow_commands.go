@@ -0,0 +1,123 @@
+package cmd
+
+import (
+  "context"
+  "fmt"
+  "strings"
+
+  "github.com/hashicorp/terraform-plugin-framework/diag"
+  "github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// workflowCommand is a line printed by a command to communicate with the provider, with the syntax:
+//   ::name key1=value1,key2=value2::message
+type workflowCommand struct {
+  Name string
+  Params map[string]string
+  Message string
+}
+
+var workflowCommandNames = map[string]struct{}{
+  "add-mask": {},
+  "debug": {},
+  "notice": {},
+  "warning": {},
+  "error": {},
+}
+
+var workflowMessageUnescaper = strings.NewReplacer("%0D", "\r", "%0A", "\n", "%25", "%")
+var workflowParamUnescaper = strings.NewReplacer("%0D", "\r", "%0A", "\n", "%3A", ":", "%2C", ",", "%25", "%")
+
+func parseWorkflowCommand(line string) (workflowCommand, bool) {
+  var command workflowCommand
+  line = strings.TrimRight(line, "\r\n")
+  if !strings.HasPrefix(line, "::") {
+    return command, false
+  }
+  header, message, found := strings.Cut(line[2:], "::")
+  if !found {
+    return command, false
+  }
+  name, params, _ := strings.Cut(header, " ")
+  if _, known := workflowCommandNames[name]; !known {
+    return command, false
+  }
+
+  command.Name = name
+  command.Params = make(map[string]string)
+  command.Message = workflowMessageUnescaper.Replace(message)
+  for _, param := range strings.Split(params, ",") {
+    if key, value, found := strings.Cut(param, "="); found {
+      command.Params[strings.TrimSpace(key)] = workflowParamUnescaper.Replace(value)
+    }
+  }
+  return command, true
+}
+
+// filterWorkflowCommands extracts the workflow commands of an output, and returns the output without them.
+func filterWorkflowCommands(output string) (string, []workflowCommand) {
+  if !strings.Contains(output, "::") {
+    return output, nil
+  }
+  var commands []workflowCommand
+  lines := strings.SplitAfter(output, "\n")
+  kept := lines[:0]
+  for _, line := range lines {
+    if command, ok := parseWorkflowCommand(line); ok {
+      commands = append(commands, command)
+    } else {
+      kept = append(kept, line)
+    }
+  }
+  return strings.Join(kept, ""), commands
+}
+
+// processOutputs executes the workflow commands printed by a command on stdout or stderr, and removes them from its outputs.
+// `::add-mask::<value>` registers a secret, `::notice::`, `::warning::` and `::error::` emit diagnostics, and `::debug::` logs a message.
+// The raw output ("stdout", "stderr", "combined" or "" for none) holds binary data, which is kept as is.
+func processOutputs(ctx context.Context, diags *diag.Diagnostics, stdout string, stderr string, combined string, raw string) (context.Context, string, string, string) {
+  filter := func(stream string, output string) (string, []workflowCommand) {
+    if stream != raw {
+      return filterWorkflowCommands(output)
+    }
+    // Masks are the only workflow commands whose absence goes unnoticed
+    if _, commands := filterWorkflowCommands(output); stream != "combined" {
+      for _, command := range commands {
+        if command.Name == "add-mask" {
+          tflog.Warn(ctx, fmt.Sprintf("::add-mask:: is ignored on %s, which is captured as binary data", stream))
+          break
+        }
+      }
+    }
+    return output, nil
+  }
+  stdout, stdoutCommands := filter("stdout", stdout)
+  stderr, stderrCommands := filter("stderr", stderr)
+  combined, _ = filter("combined", combined)
+  commands := append(stdoutCommands, stderrCommands...)
+
+  // Masks are registered first so that the other commands are redacted
+  for _, command := range commands {
+    if command.Name == "add-mask" {
+      ctx = addSecrets(ctx, command.Message)
+    }
+  }
+
+  for _, command := range commands {
+    message := redact(ctx, command.Message)
+    title := redact(ctx, command.Params["title"])
+    if title == "" {
+      title = fmt.Sprintf("%s%s from command", strings.ToUpper(command.Name[:1]), command.Name[1:])
+    }
+    switch command.Name {
+    case "debug":
+      tflog.Debug(ctx, message)
+    case "notice", "warning":
+      diags.AddWarning(title, message)
+    case "error":
+      diags.AddError(title, message)
+    }
+  }
+
+  return ctx, stdout, stderr, combined
+}
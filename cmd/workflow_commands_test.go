@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+)
+
+func TestParseWorkflowCommand(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   workflowCommand
+		wantOk bool
+	}{
+		{
+			line:   "::warning::message",
+			want:   workflowCommand{Name: "warning", Params: map[string]string{}, Message: "message"},
+			wantOk: true,
+		},
+		{
+			line:   "::error::message\r\n",
+			want:   workflowCommand{Name: "error", Params: map[string]string{}, Message: "message"},
+			wantOk: true,
+		},
+		{
+			line:   "::notice::",
+			want:   workflowCommand{Name: "notice", Params: map[string]string{}, Message: ""},
+			wantOk: true,
+		},
+		{
+			line:   "::error title=Title,file=a.txt::message",
+			want:   workflowCommand{Name: "error", Params: map[string]string{"title": "Title", "file": "a.txt"}, Message: "message"},
+			wantOk: true,
+		},
+		{
+			line:   "::warning title=A, line=2::message",
+			want:   workflowCommand{Name: "warning", Params: map[string]string{"title": "A", "line": "2"}, Message: "message"},
+			wantOk: true,
+		},
+		{
+			line:   "::warning title=a%3Ab%2Cc%25d%0Ae::message",
+			want:   workflowCommand{Name: "warning", Params: map[string]string{"title": "a:b,c%d\ne"}, Message: "message"},
+			wantOk: true,
+		},
+		{
+			line:   "::debug::line 1%0Aline 2%0D%0A100%25 :: done",
+			want:   workflowCommand{Name: "debug", Params: map[string]string{}, Message: "line 1\nline 2\r\n100% :: done"},
+			wantOk: true,
+		},
+		{
+			line:   "::add-mask::secret%3A",
+			want:   workflowCommand{Name: "add-mask", Params: map[string]string{}, Message: "secret%3A"},
+			wantOk: true,
+		},
+		{line: "::set-output name=a::1"},
+		{line: "::unknown::message"},
+		{line: "::warning message"},
+		{line: " ::warning::message"},
+		{line: "warning::message"},
+		{line: "plain output"},
+		{line: ""},
+	}
+
+	for _, test := range tests {
+		got, ok := parseWorkflowCommand(test.line)
+		if ok != test.wantOk {
+			t.Errorf("parseWorkflowCommand(%q) ok = %t, want %t", test.line, ok, test.wantOk)
+			continue
+		}
+		if ok && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseWorkflowCommand(%q) = %#v, want %#v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestProcessOutputs(t *testing.T) {
+	stdout := "out 1\n::warning::stdout warning\n::add-mask::stdout-secret\nout 2 stdout-secret\n"
+	stderr := "::add-mask::stderr-secret\nerr stderr-secret\n::notice title=Note::stderr notice\n"
+	combined := stdout + stderr
+	tests := []struct {
+		raw          string
+		wantStdout   string
+		wantStderr   string
+		wantCombined string
+		wantWarnings []string
+		wantMasked   []string
+		wantIgnored  string
+	}{
+		{
+			raw:          "",
+			wantStdout:   "out 1\nout 2 stdout-secret\n",
+			wantStderr:   "err stderr-secret\n",
+			wantCombined: "out 1\nout 2 stdout-secret\nerr stderr-secret\n",
+			wantWarnings: []string{"Warning from command: stdout warning", "Note: stderr notice"},
+			wantMasked:   []string{"stdout-secret", "stderr-secret"},
+		},
+		{
+			raw:          "stdout",
+			wantStdout:   stdout,
+			wantStderr:   "err stderr-secret\n",
+			wantCombined: "out 1\nout 2 stdout-secret\nerr stderr-secret\n",
+			wantWarnings: []string{"Note: stderr notice"},
+			wantMasked:   []string{"stderr-secret"},
+			wantIgnored:  "stdout",
+		},
+		{
+			raw:          "stderr",
+			wantStdout:   "out 1\nout 2 stdout-secret\n",
+			wantStderr:   stderr,
+			wantCombined: "out 1\nout 2 stdout-secret\nerr stderr-secret\n",
+			wantWarnings: []string{"Warning from command: stdout warning"},
+			wantMasked:   []string{"stdout-secret"},
+			wantIgnored:  "stderr",
+		},
+		{
+			raw:          "combined",
+			wantStdout:   "out 1\nout 2 stdout-secret\n",
+			wantStderr:   "err stderr-secret\n",
+			wantCombined: combined,
+			wantWarnings: []string{"Warning from command: stdout warning", "Note: stderr notice"},
+			wantMasked:   []string{"stdout-secret", "stderr-secret"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run("raw "+test.raw, func(t *testing.T) {
+			var logs bytes.Buffer
+			var diags diag.Diagnostics
+			ctx := tflogtest.RootLogger(context.Background(), &logs)
+			ctx, gotStdout, gotStderr, gotCombined := processOutputs(ctx, &diags, stdout, stderr, combined, test.raw)
+			if gotStdout != test.wantStdout || gotStderr != test.wantStderr || gotCombined != test.wantCombined {
+				t.Errorf("got outputs %q, %q, %q", gotStdout, gotStderr, gotCombined)
+			}
+
+			var warnings []string
+			for _, d := range diags {
+				warnings = append(warnings, d.Summary()+": "+d.Detail())
+			}
+			if !reflect.DeepEqual(warnings, test.wantWarnings) {
+				t.Errorf("got diagnostics %v, want %v", warnings, test.wantWarnings)
+			}
+			for _, secret := range []string{"stdout-secret", "stderr-secret"} {
+				masked := redact(ctx, secret) == "***"
+				wantMasked := false
+				for _, s := range test.wantMasked {
+					wantMasked = wantMasked || s == secret
+				}
+				if masked != wantMasked {
+					t.Errorf("%s masked is %t, want %t", secret, masked, wantMasked)
+				}
+			}
+
+			entries, err := tflogtest.MultilineJSONDecode(&logs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ignored := ""
+			for _, entry := range entries {
+				if message, _ := entry["@message"].(string); strings.HasPrefix(message, "::add-mask:: is ignored on ") {
+					ignored = strings.TrimSuffix(strings.TrimPrefix(message, "::add-mask:: is ignored on "), ", which is captured as binary data")
+				}
+			}
+			if ignored != test.wantIgnored {
+				t.Errorf("got ignored masks on %q, want %q", ignored, test.wantIgnored)
+			}
+		})
+	}
+}